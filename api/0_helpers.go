@@ -3,12 +3,15 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/fulldump/box"
 
+	"github.com/fulldump/inceptiondb/collection"
 	"github.com/fulldump/inceptiondb/database"
+	"github.com/fulldump/inceptiondb/service"
 )
 
 func getBoxContext(ctx context.Context) *box.C {
@@ -55,12 +58,14 @@ func InterceptorUnavailable(db *database.Database) box.I {
 		return func(ctx context.Context) {
 
 			status := db.GetStatus()
-			if status == database.StatusOpening {
-				box.SetError(ctx, fmt.Errorf("temporary unavailable: opening"))
-				return
-			}
-			if status == database.StatusClosing {
-				box.SetError(ctx, fmt.Errorf("temporary unavailable: closing"))
+			if status == database.StatusOpening || status == database.StatusClosing {
+				w := box.GetResponse(ctx)
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(PrettyError{
+					Message:     "temporary unavailable: " + status,
+					Description: "the database is not operating, please retry later",
+				})
 				return
 			}
 			next(ctx)
@@ -101,6 +106,64 @@ func PrettyErrorInterceptor(next box.H) box.H {
 			return
 		}
 
+		if errors.Is(err, service.ErrorCollectionLoading) ||
+			errors.Is(err, service.ErrorCollectionQuarantined) ||
+			errors.Is(err, service.ErrorCollectionClosing) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message":     err.Error(),
+					"description": "collection not available, check " + "/v1/collections:progress",
+				},
+			})
+			return
+		}
+
+		if errors.Is(err, collection.ErrRevisionMismatch) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message":     err.Error(),
+					"description": "the document has been modified, read it again",
+				},
+			})
+			return
+		}
+
+		if errors.Is(err, collection.ErrPatchTestFailed) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message":     err.Error(),
+					"description": "the document does not pass the tests of the patch",
+				},
+			})
+			return
+		}
+
+		if errors.Is(err, collection.ErrInvalidPatch) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message":     err.Error(),
+					"description": "the patch cannot be applied to the document",
+				},
+			})
+			return
+		}
+
+		conflict := &collection.IndexConflictError{}
+		if errors.As(err, &conflict) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message":     err.Error(),
+					"description": fmt.Sprintf("document rejected by index '%s'", conflict.Index),
+				},
+			})
+			return
+		}
+
 		if _, ok := err.(*json.SyntaxError); ok {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{
@@ -13,24 +13,38 @@ func BuildV1Collection(v1 *box.R, s service.Servicer) *box.R {
 		WithActions(
 			box.Get(listCollections),
 			box.Post(createCollection),
+			box.ActionPost(backupCollections).WithName("backup"),
+			box.Action(progress).WithName("progress"),
 		)
 
 	v1.Resource("/collections/{collectionName}").
+		WithInterceptors(
+			interceptorCollectionAvailable,
+		).
 		WithActions(
-			box.Get(getCollection),
-			box.ActionPost(insert),
-			box.ActionPost(insertStream),     // todo: experimental!!
-			box.ActionPost(insertFullduplex), // todo: experimental!!
+			box.Get(getCollection).WithAttribute(attrAllowQuarantined, true),
+			box.ActionPost(insert).WithAttribute(attrAutoCreate, newCollectionDefaults),
+			box.ActionPost(insertStream).WithAttribute(attrAutoCreate, noDefaults),     // todo: experimental!!
+			box.ActionPost(insertFullduplex).WithAttribute(attrAutoCreate, noDefaults), // todo: experimental!!
+			box.ActionPost(upsert).WithAttribute(attrAutoCreate, newCollectionDefaults),
+			box.ActionPost(replace),
 			box.ActionPost(find),
 			box.ActionPost(remove),
 			box.ActionPost(patch),
-			box.ActionPost(dropCollection),
+			box.ActionPost(dropCollection).WithAttribute(attrNotInFlight, true),
 			box.ActionPost(listIndexes),
-			box.ActionPost(createIndex),
-			box.ActionPost(dropIndex),
+			box.ActionPost(createIndex).WithAttribute(attrAutoCreate, newCollectionDefaults),
+			box.ActionPost(dropIndex).WithAttribute(attrAutoCreate, newCollectionDefaults),
 			box.ActionPost(getIndex),
 			box.ActionPost(size),
-			box.ActionPost(setDefaults),
+			box.ActionPost(setDefaults).WithAttribute(attrAutoCreate, newCollectionDefaults),
+			box.ActionPost(listSequences),
+			box.ActionPost(resetSequence),
+			box.ActionPost(compact),
+			box.ActionPost(status),
+			box.ActionPost(restore),
+			box.ActionPost(backup),
+			box.ActionPost(recoverCollection).WithName("recover").WithAttribute(attrAllowQuarantined, true),
 		)
 
 	v1.Resource("/collections/{collectionName}/documents/{documentId}").
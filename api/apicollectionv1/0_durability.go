@@ -0,0 +1,22 @@
+package apicollectionv1
+
+import (
+	"net/http"
+
+	"github.com/fulldump/inceptiondb/collection"
+)
+
+// getDurability returns the durability level requested with the query
+// parameter `durability`, empty means the collection level is enough
+func getDurability(w http.ResponseWriter, r *http.Request) (string, error) {
+
+	durability := r.URL.Query().Get("durability")
+
+	err := collection.ValidateDurability(durability)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return "", err
+	}
+
+	return durability, nil
+}
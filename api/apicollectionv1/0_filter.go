@@ -0,0 +1,49 @@
+package apicollectionv1
+
+import (
+	"github.com/SierraSoftworks/connor"
+
+	"github.com/fulldump/inceptiondb/utils"
+)
+
+// Documents and filters are decoded with json.Number, the comparison
+// operators of connor are replaced to compare numbers exactly and delegate
+// any other value to the original operator.
+func init() {
+	connor.Register(&numberOperator{Operator: &connor.EqualOperator{}, match: func(cmp int) bool { return cmp == 0 }})
+	connor.Register(&numberOperator{Operator: &connor.GreaterOperator{}, match: func(cmp int) bool { return cmp > 0 }})
+	connor.Register(&numberOperator{Operator: &connor.GreaterEqualOperator{}, match: func(cmp int) bool { return cmp >= 0 }})
+	connor.Register(&numberOperator{Operator: &connor.LessOperator{}, match: func(cmp int) bool { return cmp < 0 }})
+	connor.Register(&numberOperator{Operator: &connor.LessEqualOperator{}, match: func(cmp int) bool { return cmp <= 0 }})
+}
+
+type numberOperator struct {
+	connor.Operator
+	match func(cmp int) bool // tells if data matches given data compared to condition
+}
+
+func (o *numberOperator) Evaluate(condition, data interface{}) (bool, error) {
+
+	conditionNumber, ok := utils.ToNumber(condition)
+	if !ok {
+		return o.Operator.Evaluate(condition, data)
+	}
+	dataNumber, ok := utils.ToNumber(data)
+	if !ok {
+		if array, isArray := data.([]interface{}); isArray && o.Name() == "eq" {
+			for _, item := range array {
+				if m, err := o.Evaluate(condition, item); err != nil || m {
+					return m, err
+				}
+			}
+		}
+		return false, nil // a number only matches numbers
+	}
+
+	cmp, err := utils.CompareNumbers(dataNumber, conditionNumber)
+	if err != nil {
+		return false, err
+	}
+
+	return o.match(cmp), nil
+}
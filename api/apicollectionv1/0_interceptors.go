@@ -2,6 +2,12 @@ package apicollectionv1
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/fulldump/box"
 
 	"github.com/fulldump/inceptiondb/service"
 )
@@ -15,3 +21,70 @@ func SetServicer(ctx context.Context, s service.Servicer) context.Context {
 func GetServicer(ctx context.Context) service.Servicer {
 	return ctx.Value(ContextServicerKey).(service.Servicer) // TODO: can raise panic :D
 }
+
+const (
+	// attrAllowQuarantined marks the actions that can operate on a quarantined
+	// collection
+	attrAllowQuarantined = "allow_quarantined"
+
+	// attrAutoCreate marks the actions that create the collection if it does
+	// not exist, its value is the function returning its defaults
+	attrAutoCreate = "auto_create"
+
+	// attrNotInFlight marks the actions that are not in-flight operations of
+	// the collection, drop waits for the rest to finish
+	attrNotInFlight = "not_in_flight"
+)
+
+// noDefaults creates collections without defaults
+func noDefaults() map[string]any {
+	return nil
+}
+
+// interceptorCollectionAvailable rejects requests for collections that are not
+// ready, with a Retry-After while they are loading. The collection cannot be
+// dropped until the request finishes.
+func interceptorCollectionAvailable(next box.H) box.H {
+	return func(ctx context.Context) {
+
+		s := GetServicer(ctx)
+		collectionName := box.GetUrlParameter(ctx, "collectionName")
+		action := box.GetBoxContext(ctx).Action
+
+		if action.GetAttribute(attrNotInFlight) == true {
+			next(ctx)
+			return
+		}
+
+		_, release, err := s.AcquireCollection(collectionName)
+		if defaults, ok := action.GetAttribute(attrAutoCreate).(func() map[string]any); ok && err == service.ErrorCollectionNotFound {
+			_, err = s.GetOrCreateCollection(collectionName, defaults())
+			if err == nil {
+				_, release, err = s.AcquireCollection(collectionName)
+			}
+		}
+		if err == nil {
+			defer release()
+			next(ctx)
+			return
+		}
+		if err == service.ErrorCollectionNotFound {
+			next(ctx)
+			return
+		}
+		if errors.Is(err, service.ErrorCollectionQuarantined) && action.GetAttribute(attrAllowQuarantined) == true {
+			next(ctx)
+			return
+		}
+
+		w := box.GetResponse(ctx)
+		if errors.Is(err, service.ErrorCollectionLoading) || errors.Is(err, service.ErrorCollectionClosing) {
+			retryAfter := time.Second
+			if progress := s.GetProgress(collectionName); progress != nil && progress.Remaining() > retryAfter {
+				retryAfter = progress.Remaining()
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		box.SetError(ctx, err)
+	}
+}
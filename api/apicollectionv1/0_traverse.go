@@ -1,7 +1,6 @@
 package apicollectionv1
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/SierraSoftworks/connor"
@@ -23,7 +22,7 @@ func traverse(requestBody []byte, col *collection.Collection, f func(row *collec
 		Skip:   0,
 		Limit:  1,
 	}
-	err := json.Unmarshal(requestBody, &options)
+	err := utils.DecodeJSON(requestBody, &options)
 	if err != nil {
 		return err
 	}
@@ -39,7 +38,7 @@ func traverse(requestBody []byte, col *collection.Collection, f func(row *collec
 
 		if hasFilter {
 			rowData := map[string]interface{}{}
-			json.Unmarshal(r.Payload, &rowData) // todo: handle error here?
+			utils.DecodeJSON(r.Payload, &rowData) // todo: handle error here?
 
 			match, err := connor.Match(options.Filter, rowData)
 			if err != nil {
@@ -66,9 +65,15 @@ func traverse(requestBody []byte, col *collection.Collection, f func(row *collec
 		return nil
 	}
 
-	index, exists := col.Indexes[*options.Index]
+	indexes := col.Indexes()
+	index, exists := indexes[*options.Index]
 	if !exists {
-		return fmt.Errorf("index '%s' not found, available indexes %v", *options.Index, utils.GetKeys(col.Indexes))
+		for _, status := range col.ListIndexes() {
+			if status.Name == *options.Index {
+				return fmt.Errorf("index '%s' is %s, it cannot be used yet", *options.Index, status.State)
+			}
+		}
+		return fmt.Errorf("index '%s' not found, available indexes %v", *options.Index, utils.GetKeys(indexes))
 	}
 
 	index.Traverse(requestBody, iterator)
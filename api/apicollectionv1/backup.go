@@ -0,0 +1,63 @@
+package apicollectionv1
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/fulldump/box"
+
+	"github.com/fulldump/inceptiondb/collection"
+)
+
+// backup streams a tar archive with a consistent copy of the collection
+// journal, it can be restored with `--restore`
+func backup(ctx context.Context, w http.ResponseWriter) error {
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+	col, err := s.GetCollection(collectionName)
+	if err != nil {
+		return err // todo: handle/wrap this properly
+	}
+
+	return writeBackup(w, path.Base(collectionName), map[string]*collection.Collection{
+		collectionName: col,
+	})
+}
+
+// backupCollections streams a tar archive with a consistent copy of every
+// collection journal
+func backupCollections(ctx context.Context, w http.ResponseWriter) error {
+
+	s := GetServicer(ctx)
+
+	return writeBackup(w, "inceptiondb", s.ListCollections())
+}
+
+func writeBackup(w http.ResponseWriter, prefix string, collections map[string]*collection.Collection) error {
+
+	b, err := collection.NewBackup(collections)
+	if err != nil {
+		return err // todo: handle/wrap this properly
+	}
+	defer b.Close()
+
+	filename := fmt.Sprintf("%s-%s.tar", prefix, b.Time.UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	t0 := time.Now()
+	err = b.WriteTar(w)
+	if err != nil {
+		// Headers are already sent, the client gets a truncated archive
+		log.Println("ERROR: backup:", err.Error())
+		return nil
+	}
+	log.Println("BACKUP:", filename, len(collections), "collections", time.Since(t0))
+
+	return nil
+}
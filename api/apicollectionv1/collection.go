@@ -1,8 +1,23 @@
 package apicollectionv1
 
+import (
+	"github.com/fulldump/inceptiondb/database"
+)
+
 type CollectionResponse struct {
 	Name     string         `json:"name"`
 	Total    int            `json:"total"`
 	Indexes  int            `json:"indexes"`
 	Defaults map[string]any `json:"defaults"`
+	State    string         `json:"state,omitempty"` // only if not ready
+	Error    string         `json:"error,omitempty"` // why it is quarantined
+}
+
+// progressResponse describes a collection that is not ready
+func progressResponse(progress *database.CollectionProgress) *CollectionResponse {
+	return &CollectionResponse{
+		Name:  progress.Name,
+		State: progress.State,
+		Error: progress.Error,
+	}
 }
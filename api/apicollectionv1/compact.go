@@ -0,0 +1,38 @@
+package apicollectionv1
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fulldump/box"
+
+	"github.com/fulldump/inceptiondb/collection"
+)
+
+// compact rewrites the journal, the optional query parameter `compression`
+// changes the compression of the collection and converts the whole journal
+func compact(ctx context.Context, w http.ResponseWriter, r *http.Request) (*collection.CompactionStats, error) {
+
+	compression := r.URL.Query().Get("compression")
+	err := collection.ValidateCompression(compression)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+	col, err := s.GetCollection(collectionName)
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
+
+	if compression != "" {
+		err = col.SetCompression(compression)
+		if err != nil {
+			return nil, err // todo: handle/wrap this properly
+		}
+	}
+
+	return col.Compact()
+}
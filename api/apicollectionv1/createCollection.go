@@ -2,8 +2,10 @@ package apicollectionv1
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
+	"github.com/fulldump/inceptiondb/collection"
 	"github.com/fulldump/inceptiondb/service"
 )
 
@@ -22,25 +24,28 @@ func createCollection(ctx context.Context, w http.ResponseWriter, input *createC
 
 	s := GetServicer(ctx)
 
-	collection, err := s.CreateCollection(input.Name)
+	if input.Defaults == nil {
+		input.Defaults = newCollectionDefaults()
+	}
+
+	col, err := s.CreateCollection(input.Name, input.Defaults)
 	if err == service.ErrorCollectionAlreadyExists {
 		w.WriteHeader(http.StatusConflict)
 		return nil, err // todo: return custom error, with detailed description
 	}
+	if err == service.ErrorCollectionNameReserved || errors.Is(err, collection.ErrInvalidDefaults) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return nil, err // todo: wrap error?
 	}
 
-	if input.Defaults == nil {
-		input.Defaults = newCollectionDefaults()
-	}
-	collection.SetDefaults(input.Defaults)
-
 	w.WriteHeader(http.StatusCreated)
 	return &CollectionResponse{
 		Name:     input.Name,
-		Total:    len(collection.Rows),
-		Defaults: collection.Defaults,
+		Total:    len(col.Rows),
+		Defaults: col.Defaults,
 	}, nil
 }
@@ -10,7 +10,6 @@ import (
 	"github.com/fulldump/box"
 
 	"github.com/fulldump/inceptiondb/collection"
-	"github.com/fulldump/inceptiondb/service"
 )
 
 type CreateIndexRequest struct {
@@ -27,11 +26,13 @@ func createIndex(ctx context.Context, r *http.Request) (*listIndexesItem, error)
 	}
 
 	input := struct {
-		Name string
-		Type string
+		Name       string
+		Type       string
+		Background bool // answer once the index is building instead of built
 	}{
 		"",
 		"", // todo: put default index here (if any)
+		false,
 	}
 	err = json.Unmarshal(requestBody, &input)
 	if err != nil {
@@ -41,16 +42,6 @@ func createIndex(ctx context.Context, r *http.Request) (*listIndexesItem, error)
 	s := GetServicer(ctx)
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 	col, err := s.GetCollection(collectionName)
-	if err == service.ErrorCollectionNotFound {
-		col, err = s.CreateCollection(collectionName)
-		if err != nil {
-			return nil, err // todo: handle/wrap this properly
-		}
-		err = col.SetDefaults(newCollectionDefaults())
-		if err != nil {
-			return nil, err // todo: handle/wrap this properly
-		}
-	}
 	if err != nil {
 		return nil, err // todo: handle/wrap this properly
 	}
@@ -71,6 +62,20 @@ func createIndex(ctx context.Context, r *http.Request) (*listIndexesItem, error)
 		return nil, err
 	}
 
+	if input.Background {
+		err = col.IndexBackground(input.Name, options)
+		if err != nil {
+			return nil, err
+		}
+		box.GetResponse(ctx).WriteHeader(http.StatusAccepted)
+		return &listIndexesItem{
+			Name:    input.Name,
+			Type:    input.Type,
+			Options: options,
+			State:   collection.IndexBuilding,
+		}, nil
+	}
+
 	err = col.Index(input.Name, options)
 	if err != nil {
 		return nil, err
@@ -82,5 +87,6 @@ func createIndex(ctx context.Context, r *http.Request) (*listIndexesItem, error)
 		Name:    input.Name,
 		Type:    input.Type,
 		Options: options,
+		State:   collection.IndexReady,
 	}, nil
 }
@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/fulldump/box"
+
+	"github.com/fulldump/inceptiondb/service"
 )
 
 func dropCollection(ctx context.Context, w http.ResponseWriter) error {
@@ -13,5 +15,15 @@ func dropCollection(ctx context.Context, w http.ResponseWriter) error {
 
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 
-	return s.DeleteCollection(collectionName) // TODO: wrap error?
+	err := s.DeleteCollection(collectionName)
+	if err == service.ErrorCollectionNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return err
+	}
+	if err != nil {
+		return err // TODO: wrap error?
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
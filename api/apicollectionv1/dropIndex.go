@@ -5,8 +5,6 @@ import (
 	"net/http"
 
 	"github.com/fulldump/box"
-
-	"github.com/fulldump/inceptiondb/service"
 )
 
 type dropIndexRequest struct {
@@ -18,16 +16,6 @@ func dropIndex(ctx context.Context, w http.ResponseWriter, input *dropIndexReque
 	s := GetServicer(ctx)
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 	col, err := s.GetCollection(collectionName)
-	if err == service.ErrorCollectionNotFound {
-		col, err = s.CreateCollection(collectionName)
-		if err != nil {
-			return err // todo: handle/wrap this properly
-		}
-		err = col.SetDefaults(newCollectionDefaults())
-		if err != nil {
-			return err // todo: handle/wrap this properly
-		}
-	}
 	if err != nil {
 		return err // todo: handle/wrap this properly
 	}
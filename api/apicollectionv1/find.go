@@ -20,6 +20,7 @@ func find(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	input := struct {
 		Index *string
+		At    *collection.PointInTime
 	}{}
 	err = json.Unmarshal(requestBody, &input)
 	if err != nil {
@@ -33,8 +34,16 @@ func find(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		return err // todo: handle/wrap this properly
 	}
 
+	if input.At != nil {
+		col, err = openCollectionAt(col, input.At)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return err
+		}
+	}
+
 	return traverse(requestBody, col, func(row *collection.Row) bool {
-		w.Write(row.Payload)
+		w.Write(col.Document(row))
 		w.Write([]byte("\n"))
 		return true
 	})
@@ -2,6 +2,7 @@ package apicollectionv1
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/fulldump/box"
@@ -21,11 +22,17 @@ func getCollection(ctx context.Context) (*CollectionResponse, error) {
 		// todo: wrap error
 		return nil, err
 	}
+	if errors.Is(err, service.ErrorCollectionQuarantined) {
+		return progressResponse(s.GetProgress(collectionName)), nil
+	}
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
 
 	return &CollectionResponse{
 		Name:     collectionName,
 		Total:    len(collection.Rows),
-		Indexes:  len(collection.Indexes),
+		Indexes:  len(collection.Indexes()),
 		Defaults: collection.Defaults,
 	}, nil
 }
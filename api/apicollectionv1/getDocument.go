@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/fulldump/box"
 
 	"github.com/fulldump/inceptiondb/collection"
 	"github.com/fulldump/inceptiondb/service"
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 type documentLookupSource struct {
@@ -20,6 +23,7 @@ type documentLookupSource struct {
 
 type documentLookupResponse struct {
 	ID       string                `json:"id"`
+	Revision int64                 `json:"revision"`
 	Document map[string]any        `json:"document"`
 	Source   *documentLookupSource `json:"source,omitempty"`
 }
@@ -54,13 +58,29 @@ func getDocument(ctx context.Context) (*documentLookupResponse, error) {
 		return nil, fmt.Errorf("document '%s' not found", documentID)
 	}
 
+	revision := atomic.LoadInt64(&row.Revision)
+	etag := `"` + strconv.FormatInt(revision, 10) + `"`
+	w.Header().Set("ETag", etag)
+
+	r := box.GetRequest(ctx)
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" && ifMatch != etag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return nil, fmt.Errorf("%w: document is at revision %s, not %s", collection.ErrRevisionMismatch, etag, ifMatch)
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Del("Content-Type") // only the status and the ETag, no body
+		w.WriteHeader(http.StatusNotModified)
+		return nil, nil
+	}
+
 	document := map[string]any{}
-	if err := json.Unmarshal(row.Payload, &document); err != nil {
+	if err := utils.DecodeJSON(col.Document(row), &document); err != nil {
 		return nil, fmt.Errorf("decode document: %w", err)
 	}
 
 	return &documentLookupResponse{
 		ID:       documentID,
+		Revision: revision,
 		Document: document,
 		Source:   source,
 	}, nil
@@ -77,7 +97,7 @@ func findRowByID(col *collection.Collection, documentID string) (*collection.Row
 		Value string `json:"value"`
 	}
 
-	for name, idx := range col.Indexes {
+	for name, idx := range col.Indexes() {
 		if idx == nil || idx.Index == nil {
 			continue
 		}
@@ -111,7 +131,7 @@ func findRowByID(col *collection.Collection, documentID string) (*collection.Row
 
 	for _, row := range col.Rows {
 		var item map[string]any
-		if err := json.Unmarshal(row.Payload, &item); err != nil {
+		if err := utils.DecodeJSON(row.Payload, &item); err != nil {
 			continue
 		}
 		value, exists := item["id"]
@@ -21,17 +21,12 @@ func getIndex(ctx context.Context, input getIndexInput) (*listIndexesItem, error
 		return nil, err // todo: handle/wrap this properly
 	}
 
-	name := input.Name
-	index, found := current.Indexes[name]
-
-	if !found {
-		box.GetResponse(ctx).WriteHeader(http.StatusNotFound)
-		return nil, fmt.Errorf("index '%s' not found in collection '%s'", input.Name, collectionName)
+	for _, status := range current.ListIndexes() {
+		if status.Name == input.Name {
+			return newListIndexesItem(status), nil
+		}
 	}
 
-	return &listIndexesItem{
-		Name:    name,
-		Type:    index.Type,
-		Options: index.Options,
-	}, nil
+	box.GetResponse(ctx).WriteHeader(http.StatusNotFound)
+	return nil, fmt.Errorf("index '%s' not found in collection '%s'", input.Name, collectionName)
 }
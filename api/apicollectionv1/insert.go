@@ -2,14 +2,13 @@ package apicollectionv1
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/fulldump/box"
 
-	"github.com/fulldump/inceptiondb/service"
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 func insert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -20,19 +19,14 @@ func insert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		return wcerr
 	}
 
+	durability, err := getDurability(w, r)
+	if err != nil {
+		return err
+	}
+
 	s := GetServicer(ctx)
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 	collection, err := s.GetCollection(collectionName)
-	if err == service.ErrorCollectionNotFound {
-		collection, err = s.CreateCollection(collectionName)
-		if err != nil {
-			return err // todo: handle/wrap this properly
-		}
-		err = collection.SetDefaults(newCollectionDefaults())
-		if err != nil {
-			return err // todo: handle/wrap this properly
-		}
-	}
 	if err != nil {
 		return err // todo: handle/wrap this properly
 	}
@@ -40,7 +34,7 @@ func insert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	// READER
 
 	// ALT 1
-	jsonReader := json.NewDecoder(r.Body)
+	jsonReader := utils.NewJSONDecoder(r.Body)
 
 	// ALT 2
 	// jsonReader := jsontext.NewDecoder(r.Body, jsontext.AllowDuplicateNames(true))
@@ -86,6 +80,14 @@ func insert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 			return err
 		}
 
+		err = collection.Commit(durability)
+		if err != nil {
+			if i == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return err
+		}
+
 		if i == 0 {
 			w.WriteHeader(http.StatusCreated)
 		}
@@ -100,7 +102,7 @@ func insert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		// )
 
 		// ALT 3
-		w.Write(row.Payload)
+		w.Write(collection.Document(row))
 		w.Write([]byte("\n"))
 
 		// ALT 4
@@ -9,11 +9,16 @@ import (
 
 	"github.com/fulldump/box"
 
-	"github.com/fulldump/inceptiondb/service"
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 func insertFullduplex(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
+	durability, err := getDurability(w, r)
+	if err != nil {
+		return err
+	}
+
 	wc := http.NewResponseController(w)
 	wcerr := wc.EnableFullDuplex()
 	if wcerr != nil {
@@ -23,14 +28,11 @@ func insertFullduplex(ctx context.Context, w http.ResponseWriter, r *http.Reques
 	s := GetServicer(ctx)
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 	collection, err := s.GetCollection(collectionName)
-	if err == service.ErrorCollectionNotFound {
-		collection, err = s.CreateCollection(collectionName)
-	}
 	if err != nil {
 		return err // todo: handle/wrap this properly
 	}
 
-	jsonReader := json.NewDecoder(r.Body)
+	jsonReader := utils.NewJSONDecoder(r.Body)
 	jsonWriter := json.NewEncoder(w)
 
 	flusher, ok := w.(http.Flusher)
@@ -60,19 +62,26 @@ func insertFullduplex(ctx context.Context, w http.ResponseWriter, r *http.Reques
 			// w.WriteHeader(http.StatusBadRequest)
 			return err
 		}
-		_, err = collection.Insert(item)
+		row, err := collection.Insert(item)
 		if err != nil {
 			// TODO: handle error properly
 			w.WriteHeader(http.StatusConflict)
 			return err
 		}
+		err = collection.Commit(durability)
+		if err != nil {
+			if c == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return err
+		}
 		c++
 		// fmt.Println("item inserted")
 		if ok {
 			// flusher.Flush()
 		}
 
-		err = jsonWriter.Encode(item)
+		err = jsonWriter.Encode(collection.Document(row))
 		if err != nil {
 			fmt.Println("ERROR:", err.Error())
 		}
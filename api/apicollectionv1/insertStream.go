@@ -10,7 +10,7 @@ import (
 
 	"github.com/fulldump/box"
 
-	"github.com/fulldump/inceptiondb/service"
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 // how to try with curl:
@@ -19,12 +19,14 @@ import (
 // type one document and press enter
 func insertStream(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
+	durability, err := getDurability(w, r)
+	if err != nil {
+		return err
+	}
+
 	s := GetServicer(ctx)
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 	collection, err := s.GetCollection(collectionName)
-	if err == service.ErrorCollectionNotFound {
-		collection, err = s.CreateCollection(collectionName)
-	}
 	if err != nil {
 		return err // todo: handle/wrap this properly
 	}
@@ -36,7 +38,7 @@ func insertStream(ctx context.Context, w http.ResponseWriter, r *http.Request) e
 	FullDuplex(w, func(w io.Writer) {
 
 		jsonWriter := json.NewEncoder(w)
-		jsonReader := json.NewDecoder(r.Body)
+		jsonReader := utils.NewJSONDecoder(r.Body)
 
 		// w.WriteHeader(http.StatusCreated)
 
@@ -53,9 +55,14 @@ func insertStream(ctx context.Context, w http.ResponseWriter, r *http.Request) e
 				// w.WriteHeader(http.StatusBadRequest)
 				return
 			}
-			_, err = collection.Insert(item)
+			row, err := collection.Insert(item)
 			if err == nil {
-				jsonWriter.Encode(item)
+				err = collection.Commit(durability)
+				if err != nil {
+					jsonWriter.Encode(err.Error())
+					return // the status is already sent, stop here
+				}
+				jsonWriter.Encode(collection.Document(row))
 			} else {
 				// TODO: handle error properly
 				// w.WriteHeader(http.StatusConflict)
@@ -3,6 +3,8 @@ package apicollectionv1
 import (
 	"context"
 	"net/http"
+
+	"github.com/fulldump/inceptiondb/database"
 )
 
 func listCollections(ctx context.Context, w http.ResponseWriter) ([]*CollectionResponse, error) {
@@ -14,9 +16,15 @@ func listCollections(ctx context.Context, w http.ResponseWriter) ([]*CollectionR
 		response = append(response, &CollectionResponse{
 			Name:     name,
 			Total:    len(collection.Rows),
-			Indexes:  len(collection.Indexes),
+			Indexes:  len(collection.Indexes()),
 			Defaults: collection.Defaults,
 		})
 	}
+	for _, progress := range s.ListProgress() {
+		if progress.State == database.CollectionReady {
+			continue
+		}
+		response = append(response, progressResponse(progress))
+	}
 	return response, nil
 }
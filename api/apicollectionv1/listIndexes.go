@@ -6,6 +6,7 @@ import (
 
 	"github.com/fulldump/box"
 
+	"github.com/fulldump/inceptiondb/collection"
 	"github.com/fulldump/inceptiondb/utils"
 )
 
@@ -13,6 +14,8 @@ type listIndexesItem struct {
 	Name    string      `json:"name"`
 	Type    string      `json:"type"`
 	Options interface{} `json:"options"`
+	State   string      `json:"state"`
+	Error   string      `json:"error,omitempty"`
 }
 
 func (l *listIndexesItem) MarshalJSON() ([]byte, error) {
@@ -22,10 +25,23 @@ func (l *listIndexesItem) MarshalJSON() ([]byte, error) {
 		"type": l.Type,
 	}
 	utils.Remarshal(l.Options, &result)
+	result["state"] = l.State
+	if l.Error != "" {
+		result["error"] = l.Error
+	}
 
 	return json.Marshal(result)
 }
 
+func newListIndexesItem(status *collection.IndexStatus) *listIndexesItem {
+	return &listIndexesItem{
+		Name:    status.Name,
+		Type:    status.Type,
+		Options: status.Options,
+		State:   status.State,
+		Error:   status.Error,
+	}
+}
 func listIndexes(ctx context.Context) ([]*listIndexesItem, error) {
 
 	s := GetServicer(ctx)
@@ -36,13 +52,8 @@ func listIndexes(ctx context.Context) ([]*listIndexesItem, error) {
 	}
 
 	result := []*listIndexesItem{}
-	for name, index := range collection.Indexes {
-		_ = index
-		result = append(result, &listIndexesItem{
-			Name:    name,
-			Type:    index.Type,
-			Options: index.Options,
-		})
+	for _, status := range collection.ListIndexes() {
+		result = append(result, newListIndexesItem(status))
 	}
 
 	return result, nil
@@ -3,17 +3,26 @@ package apicollectionv1
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/SierraSoftworks/connor"
 	"github.com/fulldump/box"
 
 	"github.com/fulldump/inceptiondb/collection"
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 func patch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
+	durability, err := getDurability(w, r)
+	if err != nil {
+		return err
+	}
+
 	s := GetServicer(ctx)
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 	col, err := s.GetCollection(collectionName)
@@ -27,13 +36,26 @@ func patch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	}
 
 	patch := struct {
-		Filter map[string]interface{}
-		Patch  interface{}
+		Filter   map[string]interface{}
+		Patch    interface{}
+		Format   string // merge (also update operators) or json-patch, guessed if empty
+		Revision int64  // patch only if the document is at this revision
 	}{}
-	json.Unmarshal(requestBody, &patch) // TODO: handle err
+	utils.DecodeJSON(requestBody, &patch) // TODO: handle err
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json-patch+json") {
+		patch.Format = patchFormatJSONPatch
+	}
+	err = validatePatchFormat(patch.Format, patch.Patch)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
 
 	e := json.NewEncoder(w)
 
+	var patchErr, testErr error
+	patched := false
 	traverse(requestBody, col, func(row *collection.Row) bool {
 
 		row.PatchMutex.Lock()
@@ -43,7 +65,7 @@ func patch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		if hasFilter {
 
 			rowData := map[string]interface{}{}
-			json.Unmarshal(row.Payload, &rowData) // todo: handle error here?
+			utils.DecodeJSON(row.Payload, &rowData) // todo: handle error here?
 
 			match, err := connor.Match(patch.Filter, rowData)
 			if err != nil {
@@ -56,17 +78,63 @@ func patch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 			}
 		}
 
-		err := col.Patch(row, patch.Patch)
+		err := col.PatchRevision(row, patch.Patch, patch.Revision)
+		if errors.Is(err, collection.ErrPatchTestFailed) {
+			testErr = err // only this document is left untouched
+			return true
+		}
+		if err != nil {
+			patchErr = err // the row is left untouched
+			return false
+		}
+
+		err = col.Commit(durability)
 		if err != nil {
-			// TODO: handle err??
-			// return err
-			return true // todo: OR return false?
+			if !patched {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			patchErr = err // applied, but not as durable as requested
+			return false
 		}
 
-		e.Encode(row.Payload) // todo: handle err?
+		e.Encode(col.Document(row)) // todo: handle err?
+		patched = true
 
 		return true
 	})
 
-	return nil
+	if patchErr == nil && !patched {
+		return testErr
+	}
+
+	return patchErr
+}
+
+const (
+	patchFormatMerge     = "merge"
+	patchFormatJSONPatch = "json-patch"
+)
+
+// validatePatchFormat checks that patch is written in format: an object for
+// merge patches and update operators, an operation list for JSON Patch
+func validatePatchFormat(format string, patch interface{}) error {
+
+	_, isList := patch.([]interface{})
+
+	switch format {
+	case "":
+		return nil
+	case patchFormatMerge:
+		if isList {
+			return fmt.Errorf("%w: merge patch must be an object", collection.ErrInvalidPatch)
+		}
+		return nil
+	case patchFormatJSONPatch:
+		if !isList {
+			return fmt.Errorf("%w: JSON Patch must be an operation list", collection.ErrInvalidPatch)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unexpected format '%s' instead of [%s|%s]", format, patchFormatMerge, patchFormatJSONPatch)
 }
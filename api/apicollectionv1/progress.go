@@ -0,0 +1,16 @@
+package apicollectionv1
+
+import (
+	"context"
+
+	"github.com/fulldump/inceptiondb/database"
+)
+
+// progress shows the state of every collection, and the bytes of its journal
+// replayed so far while it is loading
+func progress(ctx context.Context) ([]*database.CollectionProgress, error) {
+
+	s := GetServicer(ctx)
+
+	return s.ListProgress(), nil
+}
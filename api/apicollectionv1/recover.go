@@ -0,0 +1,42 @@
+package apicollectionv1
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/fulldump/box"
+)
+
+type recoverRequest struct {
+	Recovery string `json:"recovery"` // overrides the recovery mode of the database
+}
+
+// recoverCollection loads again a quarantined collection, once its journal has
+// been fixed or with a more permissive recovery mode. The body is optional.
+func recoverCollection(ctx context.Context, w http.ResponseWriter, r *http.Request) (*CollectionResponse, error) {
+
+	input := &recoverRequest{}
+	err := json.NewDecoder(r.Body).Decode(input)
+	if err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+
+	col, err := s.RecoverCollection(collectionName, input.Recovery)
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		return nil, err
+	}
+
+	return &CollectionResponse{
+		Name:     collectionName,
+		Total:    len(col.Rows),
+		Indexes:  len(col.Indexes()),
+		Defaults: col.Defaults,
+	}, nil
+}
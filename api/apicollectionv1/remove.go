@@ -13,13 +13,19 @@ import (
 
 func remove(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
+	durability, err := getDurability(w, r)
+	if err != nil {
+		return err
+	}
+
 	requestBody, err := io.ReadAll(r.Body)
 	if err != nil {
 		return err
 	}
 
 	input := struct {
-		Index string
+		Index    string
+		Revision int64 // remove only if the document is at this revision
 	}{
 		Index: "",
 	}
@@ -38,13 +44,16 @@ func remove(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	var result error
 
 	traverse(requestBody, col, func(row *collection.Row) bool {
-		err := col.Remove(row)
+		err := col.RemoveRevision(row, input.Revision)
+		if err == nil {
+			err = col.Commit(durability)
+		}
 		if err != nil {
 			result = err
 			return false
 		}
 
-		w.Write(row.Payload)
+		w.Write(col.Document(row))
 		w.Write([]byte("\n"))
 		return true
 	})
@@ -0,0 +1,77 @@
+package apicollectionv1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/fulldump/box"
+
+	"github.com/fulldump/inceptiondb/collection"
+	"github.com/fulldump/inceptiondb/service"
+)
+
+type restoreRequest struct {
+	collection.PointInTime
+	Target string `json:"target"`
+}
+
+// restore materializes a past state of the collection into a new one
+func restore(ctx context.Context, w http.ResponseWriter, input *restoreRequest) (*CollectionResponse, error) {
+
+	if input.Target == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, fmt.Errorf("target collection is required")
+	}
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+	col, err := s.GetCollection(collectionName)
+	if err == service.ErrorCollectionNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
+
+	historical, err := openCollectionAt(col, &input.PointInTime)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+
+	target, err := s.CreateCollection(input.Target, nil)
+	if err == service.ErrorCollectionAlreadyExists {
+		w.WriteHeader(http.StatusConflict)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
+
+	err = target.ImportSnapshot(historical)
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	return &CollectionResponse{
+		Name:     input.Target,
+		Total:    len(target.Rows),
+		Indexes:  len(target.Indexes()),
+		Defaults: target.Defaults,
+	}, nil
+}
+
+// openCollectionAt returns a read only view of col in a point in time
+func openCollectionAt(col *collection.Collection, at *collection.PointInTime) (*collection.Collection, error) {
+
+	// Make sure the journal on disk contains every command
+	err := col.Commit(collection.DurabilityFlush)
+	if err != nil {
+		return nil, err
+	}
+
+	return collection.OpenCollectionAtWithOptions(col.Filename, at, col.Options())
+}
@@ -0,0 +1,45 @@
+package apicollectionv1
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fulldump/box"
+
+	"github.com/fulldump/inceptiondb/collection"
+)
+
+func listSequences(ctx context.Context) ([]*collection.Sequence, error) {
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+	col, err := s.GetCollection(collectionName)
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
+
+	return col.Sequences(), nil
+}
+
+type resetSequenceInput struct {
+	Name  string
+	Value int64 // last value taken, the next insert gets value+1
+}
+
+func resetSequence(ctx context.Context, input resetSequenceInput) (*collection.Sequence, error) {
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+	col, err := s.GetCollection(collectionName)
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
+
+	err = col.SetSequence(input.Name, input.Value)
+	if err != nil {
+		box.GetResponse(ctx).WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+
+	return &collection.Sequence{Name: input.Name, Value: input.Value}, nil
+}
@@ -3,11 +3,13 @@ package apicollectionv1
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/fulldump/box"
 
-	"github.com/fulldump/inceptiondb/service"
+	"github.com/fulldump/inceptiondb/collection"
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 type setDefaultsInput map[string]any
@@ -17,23 +19,16 @@ func setDefaults(ctx context.Context, w http.ResponseWriter, r *http.Request) er
 	s := GetServicer(ctx)
 	collectionName := box.GetUrlParameter(ctx, "collectionName")
 	col, err := s.GetCollection(collectionName)
-	if err == service.ErrorCollectionNotFound {
-		col, err = s.CreateCollection(collectionName)
-		if err != nil {
-			return err // todo: handle/wrap this properly
-		}
-		err = col.SetDefaults(newCollectionDefaults())
-		if err != nil {
-			return err // todo: handle/wrap this properly
-		}
-	}
 	if err != nil {
 		return err // todo: handle/wrap this properly
 	}
 
-	defaults := col.Defaults
+	defaults := map[string]any{}
+	for k, v := range col.Defaults {
+		defaults[k] = v
+	}
 
-	err = json.NewDecoder(r.Body).Decode(&defaults)
+	err = utils.NewJSONDecoder(r.Body).Decode(&defaults)
 	if err != nil {
 		return err // todo: handle/wrap this properly
 	}
@@ -49,6 +44,10 @@ func setDefaults(ctx context.Context, w http.ResponseWriter, r *http.Request) er
 	}
 
 	err = col.SetDefaults(defaults)
+	if errors.Is(err, collection.ErrInvalidDefaults) {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
 	if err != nil {
 		return err
 	}
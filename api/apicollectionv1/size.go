@@ -2,7 +2,6 @@ package apicollectionv1
 
 import (
 	"context"
-	"os"
 
 	"github.com/fulldump/box"
 
@@ -26,13 +25,10 @@ func size(ctx context.Context) (interface{}, error) {
 	result["memory"] = memory
 
 	// Disk
-	info, err := os.Stat(col.Filename)
-	if err == nil {
-		result["disk"] = info.Size()
-	}
+	result["disk"] = col.JournalSize()
 
 	// Indexes
-	for name, index := range col.Indexes {
+	for name, index := range col.Indexes() {
 		result["index."+name] = utils.SizeOf(index) - memory
 	}
 
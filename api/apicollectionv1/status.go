@@ -0,0 +1,43 @@
+package apicollectionv1
+
+import (
+	"context"
+
+	"github.com/fulldump/box"
+
+	"github.com/fulldump/inceptiondb/collection"
+)
+
+type collectionStatus struct {
+	Name           string                      `json:"name"`
+	Total          int                         `json:"total"`
+	Indexes        int                         `json:"indexes"`
+	Durability     string                      `json:"durability"`
+	Compression    string                      `json:"compression"`
+	EncryptionKey  string                      `json:"encryption_key,omitempty"` // id of the key for new records
+	Recovery       *collection.RecoveryReport  `json:"recovery"`
+	Load           *collection.LoadStats       `json:"load"`
+	LastCompaction *collection.CompactionStats `json:"last_compaction"`
+}
+
+func status(ctx context.Context) (*collectionStatus, error) {
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+	col, err := s.GetCollection(collectionName)
+	if err != nil {
+		return nil, err // todo: handle/wrap this properly
+	}
+
+	return &collectionStatus{
+		Name:           collectionName,
+		Total:          len(col.Rows),
+		Indexes:        len(col.Indexes()),
+		Durability:     col.Durability(),
+		Compression:    col.Compression(),
+		EncryptionKey:  col.EncryptionKeyId(),
+		Recovery:       col.Recovery,
+		Load:           col.Load,
+		LastCompaction: col.LastCompaction,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package apicollectionv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fulldump/box"
+
+	"github.com/fulldump/inceptiondb/collection"
+	"github.com/fulldump/inceptiondb/utils"
+)
+
+// upsert inserts every document of the body, or replaces the document with
+// the same key in the unique index given by the query parameter `index`
+func upsert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return writeByKey(ctx, w, r, true)
+}
+
+// replace replaces the document with the same key in the unique index given
+// by the query parameter `index` for every document of the body
+func replace(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return writeByKey(ctx, w, r, false)
+}
+
+func writeByKey(ctx context.Context, w http.ResponseWriter, r *http.Request, insert bool) error {
+
+	wc := http.NewResponseController(w)
+	wcerr := wc.EnableFullDuplex()
+	if wcerr != nil {
+		return wcerr
+	}
+
+	durability, err := getDurability(w, r)
+	if err != nil {
+		return err
+	}
+
+	index := r.URL.Query().Get("index")
+	if index == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return fmt.Errorf("query parameter 'index' is required")
+	}
+
+	s := GetServicer(ctx)
+	collectionName := box.GetUrlParameter(ctx, "collectionName")
+	col, err := s.GetCollection(collectionName)
+	if err != nil {
+		return err // todo: handle/wrap this properly
+	}
+
+	jsonReader := utils.NewJSONDecoder(r.Body)
+	for i := 0; true; i++ {
+		item := map[string]any{}
+		err := jsonReader.Decode(&item)
+		if err == io.EOF {
+			if i == 0 {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return nil
+		}
+		if err != nil {
+			if i == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			return err
+		}
+
+		var row *collection.Row
+		inserted := false
+		if insert {
+			row, inserted, err = col.Upsert(index, item)
+		} else {
+			row, err = col.Replace(index, item)
+		}
+		if err != nil {
+			if i == 0 {
+				w.WriteHeader(writeByKeyStatus(err))
+			}
+			return err
+		}
+
+		err = col.Commit(durability)
+		if err != nil {
+			if i == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return err
+		}
+
+		if i == 0 {
+			if inserted {
+				w.WriteHeader(http.StatusCreated)
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+		}
+
+		w.Write(col.Document(row))
+		w.Write([]byte("\n"))
+	}
+
+	return nil
+}
+
+func writeByKeyStatus(err error) int {
+
+	if errors.Is(err, collection.ErrDocumentNotFound) {
+		return http.StatusNotFound
+	}
+
+	conflict := &collection.IndexConflictError{}
+	if errors.As(err, &conflict) {
+		return http.StatusConflict
+	}
+
+	return http.StatusBadRequest
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fulldump/biff"
+)
+
+func TestDefaults(t *testing.T) {
+
+	_, api := newTestApi(t)
+
+	resp := api.Request("POST", "/v1/collections/orders:setDefaults").
+		WithBodyJson(map[string]any{
+			"number":         "auto(orders, 6)",
+			"meta.createdAt": "now()",
+			"meta.updatedAt": "onupdate(unixnano())",
+		}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+
+	resp = api.Request("POST", "/v1/collections/orders:insert").WithBodyJson(map[string]any{}).Do()
+	document := resp.BodyJson().(map[string]any)
+	biff.AssertEqual(document["number"], "000001")
+	meta := document["meta"].(map[string]any)
+	biff.AssertNotNil(meta["createdAt"])
+	biff.AssertNotNil(meta["updatedAt"])
+
+	resp = api.Request("POST", "/v1/collections/orders:setDefaults").
+		WithBodyJson(map[string]any{"id": "uuid4()"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+
+	resp = api.Request("POST", "/v1/collections").
+		WithBodyJson(map[string]any{"name": "invalid", "defaults": map[string]any{"token": "token(0)"}}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fulldump/biff"
+)
+
+func TestDurability(t *testing.T) {
+
+	_, api := newTestApi(t)
+
+	resp := api.Request("POST", "/v1/collections/users:insert?durability=fsync").
+		WithBodyJson(map[string]any{"id": "1"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+
+	resp = api.Request("POST", "/v1/collections/users:patch?durability=fsync").
+		WithBodyJson(map[string]any{"filter": map[string]any{"id": "1"}, "patch": map[string]any{"name": "Ana"}}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"id": "1", "name": "Ana"})
+
+	for _, action := range []string{"insert", "patch", "insertStream", "insertFullduplex"} {
+		resp = api.Request("POST", "/v1/collections/users:"+action+"?durability=forever").
+			WithBodyJson(map[string]any{"id": "2"}).Do()
+		biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fulldump/biff"
+)
+
+func TestLargeNumbers(t *testing.T) {
+
+	_, api := newTestApi(t)
+
+	resp := api.Request("POST", "/v1/collections/numbers:insert").
+		WithBodyString(`{"id":"a","n":9007199254740993,"big":18446744073709551617}
+{"id":"b","n":9007199254740992,"d":0.1}
+`).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+	biff.AssertTrue(strings.Contains(resp.BodyString(), `"n":9007199254740993`))
+
+	// Filters
+	resp = api.Request("POST", "/v1/collections/numbers:find").
+		WithBodyString(`{"filter":{"n":9007199254740993},"limit":10}`).Do()
+	biff.AssertEqual(strings.TrimSpace(resp.BodyString()), `{"big":18446744073709551617,"id":"a","n":9007199254740993}`)
+
+	resp = api.Request("POST", "/v1/collections/numbers:find").
+		WithBodyString(`{"filter":{"n":{"$lt":9007199254740993}},"limit":10}`).Do()
+	biff.AssertEqual(strings.TrimSpace(resp.BodyString()), `{"d":0.1,"id":"b","n":9007199254740992}`)
+
+	resp = api.Request("POST", "/v1/collections/numbers:find").
+		WithBodyString(`{"filter":{"d":{"$gt":0.1}},"limit":10}`).Do()
+	biff.AssertEqual(strings.TrimSpace(resp.BodyString()), ``)
+
+	resp = api.Request("POST", "/v1/collections/numbers:find").
+		WithBodyString(`{"filter":{"n":{"$in":[9007199254740992.0]}},"limit":10}`).Do()
+	biff.AssertTrue(strings.Contains(resp.BodyString(), `"id":"b"`))
+
+	// Patch
+	resp = api.Request("POST", "/v1/collections/numbers:patch").
+		WithBodyString(`{"filter":{"id":"a"},"patch":{"$inc":{"n":2,"big":1}}}`).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertTrue(strings.Contains(resp.BodyString(), `"n":9007199254740995`))
+	biff.AssertTrue(strings.Contains(resp.BodyString(), `"big":18446744073709551618`))
+
+	// Btree ordering
+	resp = api.Request("POST", "/v1/collections/numbers:createIndex").
+		WithBodyJson(map[string]any{"name": "by-n", "type": "btree", "fields": []string{"n"}}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+
+	resp = api.Request("POST", "/v1/collections/numbers:find").
+		WithBodyString(`{"index":"by-n","from":{"n":9007199254740993},"limit":10}`).Do()
+	biff.AssertEqual(strings.TrimSpace(resp.BodyString()), `{"big":18446744073709551618,"id":"a","n":9007199254740995}`)
+}
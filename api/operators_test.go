@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fulldump/biff"
+)
+
+func TestUpdateOperators(t *testing.T) {
+
+	_, api := newTestApi(t)
+
+	resp := api.Request("POST", "/v1/collections/counters:insert").
+		WithBodyJson(map[string]any{"id": "1", "visits": 1}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+
+	resp = api.Request("POST", "/v1/collections/counters:patch").WithBodyJson(map[string]any{
+		"filter": map[string]any{"id": "1"},
+		"patch": map[string]any{
+			"$inc":  map[string]any{"visits": 2},
+			"$push": map[string]any{"pages": "/home"},
+		},
+	}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"id": "1", "visits": 3, "pages": []any{"/home"}})
+
+	resp = api.Request("POST", "/v1/collections/counters:patch").WithBodyJson(map[string]any{
+		"filter": map[string]any{"id": "1"},
+		"patch":  map[string]any{"$inc": map[string]any{"pages": 1}},
+	}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+}
+
+func TestJSONPatch(t *testing.T) {
+
+	_, api := newTestApi(t)
+
+	for _, id := range []string{"1", "2"} {
+		resp := api.Request("POST", "/v1/collections/stock:insert").
+			WithBodyJson(map[string]any{"id": id, "units": 1, "tags": []any{"new"}}).Do()
+		biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+	}
+
+	patch := map[string]any{
+		"filter": map[string]any{"id": "1"},
+		"patch": []any{
+			map[string]any{"op": "test", "path": "/units", "value": 1},
+			map[string]any{"op": "replace", "path": "/units", "value": 0},
+			map[string]any{"op": "replace", "path": "/tags/0", "value": "sold"},
+		},
+	}
+	resp := api.Request("POST", "/v1/collections/stock:patch").
+		WithHeader("Content-Type", "application/json-patch+json").WithBodyJson(patch).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"id": "1", "units": 0, "tags": []any{"sold"}})
+
+	// The test fails now
+	resp = api.Request("POST", "/v1/collections/stock:patch").WithBodyJson(patch).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusConflict)
+
+	// Only the documents passing the test are patched
+	patch["filter"] = map[string]any{}
+	patch["limit"] = 10
+	resp = api.Request("POST", "/v1/collections/stock:patch").WithBodyJson(patch).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"id": "2", "units": 0, "tags": []any{"sold"}})
+
+	// Format mismatch
+	patch["format"] = "merge"
+	resp = api.Request("POST", "/v1/collections/stock:patch").WithBodyJson(patch).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+
+	resp = api.Request("POST", "/v1/collections/stock:patch").
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithBodyJson(map[string]any{"patch": map[string]any{"units": 5}}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+}
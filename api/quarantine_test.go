@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/fulldump/apitest"
+	"github.com/fulldump/biff"
+
+	"github.com/fulldump/inceptiondb/collection"
+	"github.com/fulldump/inceptiondb/database"
+	"github.com/fulldump/inceptiondb/service"
+)
+
+func TestQuarantine(t *testing.T) {
+
+	dir := t.TempDir()
+	os.WriteFile(path.Join(dir, "broken"), []byte("garbage\n"+`{"name":"insert","uuid":"1","timestamp":1,"start_byte":0,"payload":{"id":"1"}}`+"\n"), 0666)
+
+	db := database.NewDatabase(&database.Config{
+		Dir:               dir,
+		CollectionOptions: &collection.Options{Recovery: collection.RecoveryStrict},
+	})
+
+	b := Build(service.NewService(db), "", "test")
+	b.WithInterceptors(
+		InterceptorUnavailable(db),
+		RecoverFromPanic,
+		PrettyErrorInterceptor,
+	)
+	api := apitest.NewWithHandler(b)
+
+	resp := api.Request("GET", "/v1/collections").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusServiceUnavailable)
+	biff.AssertEqual(resp.Header.Get("Retry-After"), "1")
+
+	biff.AssertNil(db.Load())
+	biff.AssertEqual(db.GetStatus(), database.StatusOperating)
+
+	resp = api.Request("POST", "/v1/collections/broken:find").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusServiceUnavailable)
+
+	resp = api.Request("GET", "/v1/collections/broken").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqual(resp.BodyJson().(map[string]any)["state"], database.CollectionQuarantined)
+
+	resp = api.Request("GET", "/v1/collections").Do()
+	list := resp.BodyJson().([]any)
+	biff.AssertEqual(len(list), 1)
+	biff.AssertNotNil(list[0].(map[string]any)["error"])
+
+	resp = api.Request("POST", "/v1/collections").WithBodyJson(map[string]any{"name": "broken"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusConflict)
+
+	resp = api.Request("GET", "/v1/collections:progress").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	progress := resp.BodyJson().([]any)
+	biff.AssertEqual(len(progress), 1)
+	biff.AssertEqual(progress[0].(map[string]any)["state"], database.CollectionQuarantined)
+
+	resp = api.Request("POST", "/v1/collections/broken:recover").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusConflict) // still broken
+
+	resp = api.Request("POST", "/v1/collections/broken:recover").
+		WithBodyJson(map[string]any{"recovery": collection.RecoverySkip}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{
+		"name":     "broken",
+		"total":    1,
+		"indexes":  0,
+		"defaults": nil,
+	})
+
+	resp = api.Request("POST", "/v1/collections/broken:find").WithBodyJson(map[string]any{}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+
+	resp = api.Request("POST", "/v1/collections/broken:recover").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusConflict) // not quarantined
+}
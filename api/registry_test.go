@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fulldump/apitest"
+	"github.com/fulldump/biff"
+
+	"github.com/fulldump/inceptiondb/database"
+	"github.com/fulldump/inceptiondb/service"
+)
+
+func newTestApi(t *testing.T) (*service.Service, *apitest.Apitest) {
+	return newTestApiWithConfig(t, &database.Config{})
+}
+
+func newTestApiWithConfig(t *testing.T, config *database.Config) (*service.Service, *apitest.Apitest) {
+
+	config.Dir = t.TempDir()
+	db := database.NewDatabase(config)
+	biff.AssertNil(db.Load())
+
+	s := service.NewService(db)
+	b := Build(s, "", "test")
+	b.WithInterceptors(
+		InterceptorUnavailable(db),
+		RecoverFromPanic,
+		PrettyErrorInterceptor,
+	)
+
+	return s, apitest.NewWithHandler(b)
+}
+
+func TestRegistry_ConcurrentAutoCreate(t *testing.T) {
+
+	s, api := newTestApi(t)
+
+	n := 20
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := api.Request("POST", "/v1/collections/new:insert").
+				WithBodyJson(map[string]any{"n": i}).Do()
+			biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+		}()
+	}
+	wg.Wait()
+
+	col, err := s.GetCollection("new")
+	biff.AssertNil(err)
+	biff.AssertEqual(len(col.Rows), n)
+	biff.AssertNotNil(col.Defaults["id"])
+}
+
+func TestRegistry_DropWaitsInFlight(t *testing.T) {
+
+	s, api := newTestApi(t)
+	s.CreateCollection("users", nil)
+
+	_, release, err := s.AcquireCollection("users")
+	biff.AssertNil(err)
+
+	dropped := make(chan int)
+	go func() {
+		resp := api.Request("POST", "/v1/collections/users:dropCollection").Do()
+		dropped <- resp.StatusCode
+	}()
+
+	select {
+	case <-dropped:
+		t.Fatal("drop did not wait for the operation in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err = s.GetCollection("users")
+	biff.AssertNil(err) // still usable by the operation in flight
+
+	release()
+	biff.AssertEqual(<-dropped, http.StatusNoContent)
+
+	_, _, err = s.AcquireCollection("users")
+	biff.AssertEqual(err, service.ErrorCollectionNotFound)
+
+	resp := api.Request("POST", "/v1/collections/users:dropCollection").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusNotFound)
+}
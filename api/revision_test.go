@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fulldump/biff"
+
+	"github.com/fulldump/inceptiondb/collection"
+	"github.com/fulldump/inceptiondb/database"
+)
+
+func TestRevision(t *testing.T) {
+
+	_, api := newTestApiWithConfig(t, &database.Config{
+		CollectionOptions: &collection.Options{RevisionField: "_rev"},
+	})
+
+	resp := api.Request("POST", "/v1/collections/users:insert").
+		WithBodyJson(map[string]any{"id": "1", "name": "Ana", "_rev": 7}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"_rev": 1, "id": "1", "name": "Ana"})
+
+	// Patch
+	patch := map[string]any{
+		"filter":   map[string]any{"id": "1"},
+		"patch":    map[string]any{"name": "Anna"},
+		"revision": 1,
+	}
+	resp = api.Request("POST", "/v1/collections/users:patch").WithBodyJson(patch).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"_rev": 2, "id": "1", "name": "Anna"})
+
+	resp = api.Request("POST", "/v1/collections/users:patch").WithBodyJson(patch).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusConflict)
+
+	// Document
+	resp = api.Request("GET", "/v1/collections/users/documents/1").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqual(resp.Header.Get("ETag"), `"2"`)
+	biff.AssertEqualJson(resp.BodyJsonMap()["revision"], 2)
+	biff.AssertEqualJson(resp.BodyJsonMap()["document"], map[string]any{"_rev": 2, "id": "1", "name": "Anna"})
+
+	resp = api.Request("GET", "/v1/collections/users/documents/1").WithHeader("If-None-Match", `"2"`).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusNotModified)
+	biff.AssertEqual(resp.Header.Get("ETag"), `"2"`)
+	biff.AssertEqual(resp.Header.Get("Content-Type"), "")
+	biff.AssertEqual(resp.BodyString(), "")
+
+	resp = api.Request("GET", "/v1/collections/users/documents/1").WithHeader("If-Match", `"1"`).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusPreconditionFailed)
+
+	// Remove
+	remove := map[string]any{
+		"filter":   map[string]any{"id": "1"},
+		"revision": 1,
+	}
+	resp = api.Request("POST", "/v1/collections/users:remove").WithBodyJson(remove).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusConflict)
+
+	remove["revision"] = 2
+	resp = api.Request("POST", "/v1/collections/users:remove").WithBodyJson(remove).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+
+	resp = api.Request("GET", "/v1/collections/users/documents/1").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusNotFound)
+}
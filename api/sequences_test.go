@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fulldump/biff"
+)
+
+func TestSequences(t *testing.T) {
+
+	_, api := newTestApi(t)
+
+	resp := api.Request("POST", "/v1/collections/orders:setDefaults").
+		WithBodyJson(map[string]any{"id": "auto(orders)"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+
+	resp = api.Request("POST", "/v1/collections/orders:insert").WithBodyJson(map[string]any{}).Do()
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"id": 1})
+
+	resp = api.Request("POST", "/v1/collections/orders:listSequences").Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), []any{map[string]any{"name": "orders", "value": 1}})
+
+	resp = api.Request("POST", "/v1/collections/orders:resetSequence").
+		WithBodyJson(map[string]any{"name": "orders", "value": 1000}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"name": "orders", "value": 1000})
+
+	resp = api.Request("POST", "/v1/collections/orders:insert").WithBodyJson(map[string]any{}).Do()
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"id": 1001})
+
+	resp = api.Request("POST", "/v1/collections/orders:resetSequence").
+		WithBodyJson(map[string]any{"value": 1}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fulldump/biff"
+)
+
+func TestUpsert(t *testing.T) {
+
+	_, api := newTestApi(t)
+
+	resp := api.Request("POST", "/v1/collections/users:createIndex").
+		WithBodyJson(map[string]any{"name": "by-email", "type": "map", "field": "email"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+
+	// Streamed documents
+	body := `{"email":"ana@example.com","name":"Ana"}
+{"email":"bob@example.com","name":"Bob"}
+{"email":"ana@example.com","name":"Anna"}
+`
+	resp = api.Request("POST", "/v1/collections/users:upsert?index=by-email").
+		WithBodyString(body).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+	lines := strings.Split(strings.TrimSpace(resp.BodyString()), "\n")
+	biff.AssertEqual(len(lines), 3)
+
+	resp = api.Request("POST", "/v1/collections/users:find").
+		WithBodyJson(map[string]any{"index": "by-email", "value": "ana@example.com"}).Do()
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"email": "ana@example.com", "name": "Anna"})
+
+	resp = api.Request("GET", "/v1/collections/users").Do()
+	biff.AssertEqualJson(resp.BodyJsonMap()["total"], 2)
+
+	// Replace
+	resp = api.Request("POST", "/v1/collections/users:replace?index=by-email").
+		WithBodyJson(map[string]any{"email": "bob@example.com", "name": "Robert"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusOK)
+	biff.AssertEqualJson(resp.BodyJson(), map[string]any{"email": "bob@example.com", "name": "Robert"})
+
+	resp = api.Request("POST", "/v1/collections/users:replace?index=by-email").
+		WithBodyJson(map[string]any{"email": "eve@example.com"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusNotFound)
+
+	// Errors
+	resp = api.Request("POST", "/v1/collections/users:upsert").
+		WithBodyJson(map[string]any{"email": "eve@example.com"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+
+	resp = api.Request("POST", "/v1/collections/users:upsert?index=missing").
+		WithBodyJson(map[string]any{"email": "eve@example.com"}).Do()
+	biff.AssertEqual(resp.StatusCode, http.StatusBadRequest)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/fulldump/box"
 
 	"github.com/fulldump/inceptiondb/api"
+	"github.com/fulldump/inceptiondb/collection"
 	"github.com/fulldump/inceptiondb/configuration"
 	"github.com/fulldump/inceptiondb/database"
 	"github.com/fulldump/inceptiondb/service"
@@ -24,8 +25,37 @@ var VERSION = "dev"
 
 func Bootstrap(c *configuration.Configuration) (start, stop func()) {
 
+	keyring, err := collection.NewKeyring(c.EncryptionKey, c.EncryptionKeyFile, c.EncryptionOldKeys)
+	if err != nil {
+		log.Println("ERROR:", err.Error())
+		os.Exit(-1)
+	}
+	if keyring != nil && keyring.Current != nil {
+		log.Println("journal encryption enabled, key", collection.KeyId(keyring.Current))
+	}
+
+	if c.Restore != "" {
+		err := restoreBackup(c.Restore, c.Dir)
+		if err != nil {
+			log.Println("ERROR:", err.Error())
+			os.Exit(-1)
+		}
+		log.Println("restored", c.Restore, "into", c.Dir)
+	}
+
 	db := database.NewDatabase(&database.Config{
-		Dir: c.Dir,
+		Dir:         c.Dir,
+		LoadWorkers: c.LoadWorkers,
+		CollectionOptions: &collection.Options{
+			CompactAfter:  c.CompactAfter,
+			Durability:    c.Durability,
+			Recovery:      c.Recovery,
+			SegmentSize:   c.SegmentSize,
+			SegmentAge:    c.SegmentAge,
+			Compression:   c.Compression,
+			Keyring:       keyring,
+			RevisionField: c.RevisionField,
+		},
 	})
 
 	b := api.Build(service.NewService(db), c.Statics, VERSION)
@@ -105,3 +135,12 @@ func Bootstrap(c *configuration.Configuration) (start, stop func()) {
 
 	return
 }
+
+func restoreBackup(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	defer f.Close()
+	return database.Restore(f, dir)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/fulldump/goconfig"
+
+	"github.com/fulldump/inceptiondb/collection"
+)
+
+type Config struct {
+	Action string `usage:"what to do: DUMP | STATS | VERIFY | REWRITE"`
+	File   string `usage:"collection file, the journal of a collection (segments are found through its manifest)"`
+
+	// Dump filters
+	Name     string `usage:"dump: only commands with this name (insert, patch, replace, remove, index, drop_index, set_defaults...)"`
+	RowId    int64  `usage:"dump: only commands for this row id"`
+	Uuid     string `usage:"dump: only the command with this uuid"`
+	From     int64  `usage:"dump: only commands from this timestamp (unix nano)"`
+	To       int64  `usage:"dump: only commands up to this timestamp (unix nano)"`
+	Contains string `usage:"dump: only commands whose payload contains this text"`
+	Limit    int64  `usage:"dump: maximum number of commands (0 means no limit)"`
+
+	Recovery string `usage:"what to do with invalid records: strict | truncate | skip | quarantine (default: skip, strict for verify, quarantine for rewrite)"`
+	Output   string `usage:"rewrite: new file for the rewritten journal instead of replacing it"`
+
+	EncryptionKey     string `usage:"base64 key to read encrypted journals, better set with the environment variable ENCRYPTIONKEY"`
+	EncryptionKeyFile string `usage:"file with the base64 key to read encrypted journals"`
+	EncryptionOldKeys string `usage:"comma separated previous base64 keys"`
+}
+
+func main() {
+
+	c := Config{
+		Action: "stats",
+	}
+	goconfig.Read(&c)
+
+	if c.File == "" {
+		log.Fatal("--file is required")
+	}
+
+	keyring, err := collection.NewKeyring(c.EncryptionKey, c.EncryptionKeyFile, c.EncryptionOldKeys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	options := &collection.Options{
+		Recovery: c.Recovery,
+		Keyring:  keyring,
+	}
+
+	switch strings.ToUpper(c.Action) {
+	case "DUMP":
+		err = Dump(c, options)
+	case "STATS":
+		err = Stats(c, options)
+	case "VERIFY":
+		err = Verify(c, options)
+	case "REWRITE":
+		err = Rewrite(c, options)
+	default:
+		log.Fatalf("Unknown action %s", c.Action)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func defaultRecovery(options *collection.Options, recovery string) {
+	if options.Recovery == "" {
+		options.Recovery = recovery
+	}
+}
+
+// Dump prints the commands matching the filters, one JSON per line
+func Dump(c Config, options *collection.Options) error {
+
+	defaultRecovery(options, collection.RecoverySkip)
+
+	e := json.NewEncoder(os.Stdout)
+	e.SetEscapeHTML(false)
+
+	n := int64(0)
+	report, err := collection.ScanJournal(c.File, options, func(command *collection.Command) error {
+		if c.Name != "" && command.Name != c.Name {
+			return nil
+		}
+		if c.RowId != 0 && command.RowId != c.RowId {
+			return nil
+		}
+		if c.Uuid != "" && command.Uuid != c.Uuid {
+			return nil
+		}
+		if c.From != 0 && command.Timestamp < c.From {
+			return nil
+		}
+		if c.To != 0 && command.Timestamp > c.To {
+			return collection.ErrStopScan
+		}
+		if c.Contains != "" && !bytes.Contains(command.Payload, []byte(c.Contains)) {
+			return nil
+		}
+		n++
+		if c.Limit > 0 && n > c.Limit {
+			return collection.ErrStopScan
+		}
+		return e.Encode(command)
+	})
+	if err != nil {
+		return err
+	}
+
+	printCorrupted(report)
+
+	return nil
+}
+
+// Stats prints the statistics of the journal
+func Stats(c Config, options *collection.Options) error {
+
+	defaultRecovery(options, collection.RecoverySkip)
+
+	stats, err := collection.Inspect(c.File, options)
+	if err != nil {
+		return err
+	}
+
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "    ")
+	return e.Encode(stats)
+}
+
+// Verify replays the journal and fails if it is not healthy
+func Verify(c Config, options *collection.Options) error {
+
+	defaultRecovery(options, collection.RecoveryStrict)
+
+	stats, err := collection.Inspect(c.File, options)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+
+	printCorrupted(stats.Recovery)
+
+	if len(stats.Recovery.Corrupted) > 0 || stats.Recovery.TruncatedBytes > 0 {
+		return fmt.Errorf("verify: %d invalid records, %d bytes of torn tail",
+			len(stats.Recovery.Corrupted), stats.Recovery.TruncatedBytes)
+	}
+
+	fmt.Println("OK:", stats.Recovery.Commands, "commands,", stats.Rows, "rows,", len(stats.Indexes), "indexes")
+
+	return nil
+}
+
+// Rewrite compacts the journal, leaving invalid records out. With --output
+// the original journal is not modified.
+func Rewrite(c Config, options *collection.Options) error {
+
+	defaultRecovery(options, collection.RecoveryQuarantine)
+
+	if c.Output == "" {
+		col, err := collection.OpenCollectionWithOptions(c.File, options)
+		if err != nil {
+			return err
+		}
+		printCorrupted(col.Recovery)
+		stats, err := col.Compact()
+		if err != nil {
+			col.Close()
+			return err
+		}
+		fmt.Println("REWRITTEN:", c.File, stats.Rows, "rows", stats.BytesBefore, "->", stats.BytesAfter, "bytes")
+		return col.Close()
+	}
+
+	if _, err := os.Stat(c.Output); !os.IsNotExist(err) {
+		return fmt.Errorf("output '%s' already exists", c.Output)
+	}
+
+	source, err := collection.OpenCollectionAtWithOptions(c.File, &collection.PointInTime{Timestamp: 1<<63 - 1}, options)
+	if err != nil {
+		return err
+	}
+	printCorrupted(source.Recovery)
+
+	target, err := collection.OpenCollectionWithOptions(c.Output, options)
+	if err != nil {
+		return err
+	}
+	err = target.ImportSnapshot(source)
+	if err != nil {
+		target.Close()
+		return err
+	}
+	fmt.Println("REWRITTEN:", c.Output, len(target.Rows), "rows")
+
+	return target.Close()
+}
+
+func printCorrupted(report *collection.RecoveryReport) {
+	for _, corrupted := range report.Corrupted {
+		fmt.Fprintf(os.Stderr, "INVALID: %s byte %d (%d bytes): %s\n", corrupted.Segment, corrupted.Offset, corrupted.Length, corrupted.Error)
+	}
+	if report.TruncatedBytes > 0 {
+		fmt.Fprintf(os.Stderr, "TORN TAIL: %d bytes\n", report.TruncatedBytes)
+	}
+}
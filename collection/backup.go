@@ -0,0 +1,195 @@
+package collection
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backup is a consistent point of the journals of a set of collections: every
+// persisted operation finished before it is included and none started after
+// it. Journals are append only, so capturing their sizes is enough. Journal
+// files are kept open until Close, so compaction or drop can remove or replace
+// them while the backup is streamed.
+//
+// The archive has the layout of a data directory, so it can be restored by
+// extracting it into an empty one.
+type Backup struct {
+	Time  time.Time
+	files []*backupFile
+}
+
+type backupFile struct {
+	name    string   // name in the archive
+	file    *os.File // file on disk, nil for content
+	size    int64
+	content []byte
+}
+
+// NewBackup captures the journals of collections, a map from the name of the
+// collection in the archive (its path relative to the data directory) to the
+// collection.
+func NewBackup(collections map[string]*Collection) (*Backup, error) {
+
+	names := make([]string, 0, len(collections))
+	for name := range collections {
+		names = append(names, name)
+	}
+	sort.Strings(names) // always lock in the same order
+
+	b := &Backup{
+		Time: time.Now(),
+	}
+
+	// Locks are held only to capture the files, not to stream them
+	locked := make([]*Collection, 0, len(names))
+	for _, name := range names {
+		c := collections[name]
+		c.compactMutex.Lock()
+		locked = append(locked, c)
+	}
+	for _, c := range locked {
+		c.commitMutex.Lock()
+	}
+	defer func() {
+		for _, c := range locked {
+			c.commitMutex.Unlock()
+			c.compactMutex.Unlock()
+		}
+	}()
+
+	for i, c := range locked {
+		files, err := c.backupFiles(names[i])
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("backup '%s': %w", names[i], err)
+		}
+		b.files = append(b.files, files...)
+	}
+
+	return b, nil
+}
+
+// backupFiles flushes the journal and captures its files. Caller must hold
+// compactMutex and commitMutex.
+func (c *Collection) backupFiles(name string) ([]*backupFile, error) {
+
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+
+	if c.file == nil {
+		return nil, fmt.Errorf("collection is closed")
+	}
+
+	err := c.buffer.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("flush journal: %w", err)
+	}
+
+	files := []*backupFile{}
+
+	base := filepath.Base(c.Filename)
+	journalFiles := c.journalFiles()
+	if journalFiles[0] != c.Filename {
+		files = append(files, &backupFile{name: name, content: []byte{}}) // collection anchor
+	}
+	closeFiles := func() {
+		for _, file := range files {
+			file.close()
+		}
+	}
+	for _, filename := range journalFiles {
+		f, err := os.Open(filename)
+		if err != nil {
+			closeFiles()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			closeFiles()
+			return nil, err
+		}
+		files = append(files, &backupFile{
+			name: name + strings.TrimPrefix(filepath.Base(filename), base),
+			file: f,
+			size: info.Size(),
+		})
+	}
+
+	if c.manifest != nil {
+		// Segment names follow the name of the collection in the archive
+		manifest := &Manifest{}
+		for _, segment := range c.manifest.Segments {
+			renamed := *segment
+			renamed.Name = path.Base(name) + strings.TrimPrefix(segment.Name, base)
+			manifest.Segments = append(manifest.Segments, &renamed)
+		}
+		content, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("encode manifest: %w", err)
+		}
+		files = append(files, &backupFile{name: name + manifestSuffix, content: content})
+	}
+
+	return files, nil
+}
+
+// WriteTar streams the backup as a tar archive
+func (b *Backup) WriteTar(w io.Writer) error {
+
+	tw := tar.NewWriter(w)
+
+	for _, file := range b.files {
+
+		size := file.size
+		if file.file == nil {
+			size = int64(len(file.content))
+		}
+
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.name,
+			Size:     size,
+			Mode:     0666,
+			ModTime:  b.Time,
+		})
+		if err != nil {
+			return fmt.Errorf("write '%s': %w", file.name, err)
+		}
+
+		if file.file == nil {
+			_, err = tw.Write(file.content)
+		} else {
+			_, err = io.Copy(tw, io.NewSectionReader(file.file, 0, size))
+		}
+		if err != nil {
+			return fmt.Errorf("write '%s': %w", file.name, err)
+		}
+	}
+
+	return tw.Close()
+}
+
+func (f *backupFile) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// Close releases the journal files captured by the backup
+func (b *Backup) Close() {
+	for _, file := range b.files {
+		file.close()
+	}
+	b.files = nil
+}
@@ -0,0 +1,181 @@
+package collection
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/fulldump/biff"
+)
+
+func extractTar(archive []byte, dir string) []string {
+
+	names := []string{}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return names
+		}
+		names = append(names, header.Name)
+		content, _ := io.ReadAll(tr)
+		os.WriteFile(filepath.Join(dir, header.Name), content, 0666)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{SegmentSize: 1024})
+		defer c.Drop()
+		c.Index("my-index", &IndexMapOptions{Field: "id"})
+		for i := 0; i < 50; i++ {
+			c.Insert(map[string]interface{}{"id": strconv.Itoa(i)})
+		}
+		c.Compact()
+		for i := 50; i < 100; i++ {
+			c.Insert(map[string]interface{}{"id": strconv.Itoa(i)})
+		}
+
+		// Run
+		b, err := NewBackup(map[string]*Collection{"users": c})
+		AssertNil(err)
+		c.Insert(map[string]interface{}{"id": "100"}) // not in the backup
+		archive := &bytes.Buffer{}
+		err = b.WriteTar(archive)
+		b.Close()
+
+		// Check
+		AssertNil(err)
+		dir, _ := os.MkdirTemp("", "backup")
+		defer os.RemoveAll(dir)
+		names := extractTar(archive.Bytes(), dir)
+		AssertEqual(names[0], "users")
+		AssertInArray(names, "users.manifest")
+
+		restored, err := OpenCollectionWithOptions(filepath.Join(dir, "users"), &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		defer restored.Close()
+		AssertEqual(len(restored.Rows), 100)
+		AssertEqual(len(restored.indexes), 1)
+	})
+}
+
+func TestBackup_ConcurrentWrites(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+
+		wg := &sync.WaitGroup{}
+		stop := make(chan struct{})
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						c.Insert(map[string]interface{}{"name": "Fulanez"})
+					}
+				}
+			}()
+		}
+
+		// Run
+		b, err := NewBackup(map[string]*Collection{"users": c})
+		AssertNil(err)
+		archive := &bytes.Buffer{}
+		b.WriteTar(archive)
+		b.Close()
+		close(stop)
+		wg.Wait()
+
+		// Check
+		dir, _ := os.MkdirTemp("", "backup")
+		defer os.RemoveAll(dir)
+		extractTar(archive.Bytes(), dir)
+		restored, err := OpenCollectionWithOptions(filepath.Join(dir, "users"), &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		defer restored.Close()
+		AssertEqual(restored.Recovery.TruncatedBytes, int64(0))
+		AssertTrue(len(restored.Rows) <= len(c.Rows))
+	})
+}
+
+func TestBackup_Closed(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		c.Close()
+
+		_, err := NewBackup(map[string]*Collection{"users": c})
+		AssertNotNil(err)
+
+		_, err = c.Compact() // not locked by the failed backup
+		AssertNotNil(err)
+	})
+}
+
+func TestBackup_DropWhileStreaming(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		for i := 0; i < 1000; i++ { // larger than a copy buffer
+			c.Insert(map[string]interface{}{"id": strconv.Itoa(i)})
+		}
+		c.Close()
+		c, _ = OpenCollectionWithOptions(filename, &Options{SegmentSize: 1024}) // keeps the first journal file
+		for i := 1000; i < 1100; i++ {
+			c.Insert(map[string]interface{}{"id": strconv.Itoa(i)})
+		}
+		b, err := NewBackup(map[string]*Collection{"users": c})
+		AssertNil(err)
+		defer b.Close()
+
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(b.WriteTar(w))
+		}()
+		archive := &bytes.Buffer{}
+		io.CopyN(archive, r, 512) // the client is still reading
+
+		// Run
+		dropped := make(chan error)
+		go func() {
+			_, err := c.Compact()
+			if err == nil {
+				err = c.Drop()
+			}
+			dropped <- err
+		}()
+		select {
+		case err = <-dropped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("drop blocked by the backup")
+		}
+		AssertNil(err)
+		_, err = io.Copy(archive, r)
+		AssertNil(err)
+
+		// Check
+		dir, _ := os.MkdirTemp("", "backup")
+		defer os.RemoveAll(dir)
+		extractTar(archive.Bytes(), dir)
+		restored, err := OpenCollectionWithOptions(filepath.Join(dir, "users"), &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		defer restored.Close()
+		AssertEqual(len(restored.Rows), 1100)
+	})
+}
@@ -4,8 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"reflect"
@@ -13,7 +13,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	json2 "github.com/go-json-experiment/json"
 	"github.com/go-json-experiment/json/jsontext"
 
 	"github.com/google/uuid"
@@ -22,30 +21,109 @@ import (
 )
 
 type Collection struct {
-	Filename     string // Just informative...
-	file         *os.File
-	Rows         []*Row
-	rowsMutex    *sync.Mutex
-	Indexes      map[string]*collectionIndex // todo: protect access with mutex or use sync.Map
-	buffer       *bufio.Writer               // TODO: use write buffer to improve performance (x3 in tests)
-	Defaults     map[string]any
-	Count        int64
-	encoderMutex *sync.Mutex
+	Filename      string // Just informative...
+	file          *os.File
+	Rows          []*Row
+	rowsById      map[int64]*Row
+	lastRowId     int64
+	rowsMutex     *sync.Mutex
+	indexes       map[string]*collectionIndex // protected by indexesMutex
+	indexesMutex  *sync.RWMutex
+	buffer        *bufio.Writer // TODO: use write buffer to improve performance (x3 in tests)
+	Defaults      map[string]any
+	defaultValues []*defaultValue // compiled Defaults
+	encoderMutex  *sync.Mutex
+	commitMutex   *sync.RWMutex // held (R) by every persisted operation, (W) to take a consistent snapshot
+	options       *Options
 
 	lastWritesCounter int64
 	lastFlushCounter  int64
+
+	writtenSeq int64 // commands written into buffer, protected by encoderMutex
+	syncedSeq  int64 // commands made durable by group commit, protected by syncMutex
+	syncing    bool
+	syncMutex  *sync.Mutex
+	syncCond   *sync.Cond
+
+	compactMutex         *sync.Mutex
+	compactPending       *bytes.Buffer // commands written while a compaction is running
+	commandsSinceCompact int64
+	autoCompacting       int32 // an automatic compaction is running, atomic access
+	LastCompaction       *CompactionStats
+	Recovery             *RecoveryReport // outcome of reading the journal on open
+	Load                 *LoadStats      // timings of reading the journal on open
+
+	deferIndexes bool // rows are indexed in bulk once the journal is replayed
+
+	manifest     *Manifest // nil if the journal is not segmented, protected by encoderMutex
+	segmentBytes int64     // size of the active segment, protected by encoderMutex
+
+	compressionSetting string  // set by SetCompression, protected by encoderMutex
+	sealer             *sealer // encrypts new journal records, nil if disabled
+
+	sequences      map[string]int64 // last value taken of every sequence, protected by sequencesMutex
+	sequencesMutex *sync.Mutex
+}
+
+// Options tune the behaviour of a collection, a nil value means defaults
+type Options struct {
+	// CompactAfter triggers a background compaction once that number of commands
+	// has been written since the last one. Zero disables automatic compaction.
+	CompactAfter int64 `json:"compact_after"`
+
+	// Durability is the level every write must reach before returning, one of
+	// the Durability* constants. Empty means DurabilityBuffered.
+	Durability string `json:"durability"`
+
+	// Recovery decides what to do with invalid journal records, one of the
+	// Recovery* constants. Empty means RecoveryTruncate.
+	Recovery string `json:"recovery"`
+
+	// SegmentSize and SegmentAge rotate the journal into a new segment once the
+	// active one reaches that size in bytes or that age (checked on write).
+	// Zero disables each threshold, both zero keeps a single journal file.
+	SegmentSize int64         `json:"segment_size"`
+	SegmentAge  time.Duration `json:"segment_age"`
+
+	// Compression is the algorithm for new journal writes of collections that
+	// have not set their own, one of the Compression* constants. Empty means
+	// CompressionNone.
+	Compression string `json:"compression"`
+
+	// Keyring enables the encryption of new journal records with its current
+	// key, and the reading of records encrypted with any of its keys.
+	Keyring *Keyring `json:"-"`
+
+	// Progress is called while the journal is replayed on open with the bytes
+	// read so far and the size of the journal.
+	Progress func(replayed, total int64) `json:"-"`
+
+	// RevisionField is the field that exposes the revision of every document
+	// returned by Document. Empty means revisions are not exposed as a field.
+	RevisionField string `json:"revision_field"`
 }
 
 type collectionIndex struct {
 	Index
 	Type    string
 	Options interface{}
+
+	state string      // one of the Index* states, protected by indexesMutex
+	err   error       // why the build failed
+	build *indexBuild // nil once the index is ready
+	done  chan struct{}
+
+	keyMutex sync.Mutex // held by upserts keyed on the index
 }
 
 type Row struct {
-	I          int // position in Rows
+	I          int   // position in Rows
+	Id         int64 // internal identifier, immutable
 	Payload    json.RawMessage
+	Revision   int64 // starts at 1 and increases with every patch, atomic access
 	PatchMutex sync.Mutex
+
+	writeMutex sync.Mutex // held by every write of the row, so they are journaled in the order they are applied
 }
 
 type EncoderMachine struct {
@@ -76,112 +154,81 @@ var encPool = sync.Pool{
 }
 
 func OpenCollection(filename string) (*Collection, error) {
+	return OpenCollectionWithOptions(filename, nil)
+}
 
-	// TODO: initialize, read all file and apply its changes into memory
-	f, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
-	if err != nil {
-		return nil, fmt.Errorf("open file for read: %w", err)
-	}
+func OpenCollectionWithOptions(filename string, options *Options) (*Collection, error) {
 
-	collection := &Collection{
-		Rows:         []*Row{},
-		rowsMutex:    &sync.Mutex{},
-		Filename:     filename,
-		Indexes:      map[string]*collectionIndex{},
-		encoderMutex: &sync.Mutex{},
+	if options == nil {
+		options = &Options{}
 	}
 
-	j := jsontext.NewDecoder(f,
-		jsontext.AllowDuplicateNames(true),
-		jsontext.AllowInvalidUTF8(true),
-	)
+	err := ValidateDurability(options.Durability)
+	if err != nil {
+		return nil, err
+	}
 
-	command := &Command{}
+	err = ValidateRecovery(options.Recovery)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		command.Payload = nil
+	err = ValidateCompression(options.Compression)
+	if err != nil {
+		return nil, err
+	}
 
-		err := json2.UnmarshalDecode(j, &command)
-		if err == io.EOF {
-			break
-		}
+	var sealer *sealer
+	if options.Keyring != nil && options.Keyring.Current != nil {
+		sealer, err = newSealer(options.Keyring.Current)
 		if err != nil {
-			// todo: try a best effort?
-			return nil, fmt.Errorf("decode json: %w", err)
+			return nil, fmt.Errorf("encryption key: %w", err)
 		}
+	}
 
-		switch command.Name {
-		case "insert":
-			_, err := collection.addRow(command.Payload)
-			if err != nil {
-				return nil, err
-			}
-		case "drop_index":
-			dropIndexCommand := &DropIndexCommand{}
-			json.Unmarshal(command.Payload, dropIndexCommand) // Todo: handle error properly
+	// TODO: initialize, read all file and apply its changes into memory
+	f, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("open file for read: %w", err)
+	}
+	f.Close()
 
-			err := collection.dropIndex(dropIndexCommand.Name, false)
-			if err != nil {
-				fmt.Printf("WARNING: drop index '%s': %s\n", dropIndexCommand.Name, err.Error())
-				// TODO: stop process? if error might get inconsistent state
-			}
-		case "index": // todo: rename to create_index
-			indexCommand := &CreateIndexCommand{}
-			json.Unmarshal(command.Payload, indexCommand) // Todo: handle error properly
-
-			var options interface{}
-
-			switch indexCommand.Type {
-			case "map":
-				options = &IndexMapOptions{}
-				utils.Remarshal(indexCommand.Options, options)
-			case "btree":
-				options = &IndexBTreeOptions{}
-				utils.Remarshal(indexCommand.Options, options)
-			default:
-				return nil, fmt.Errorf("index command: unexpected type '%s' instead of [map|btree]", indexCommand.Type)
-			}
+	collection := newCollection(filename, options)
+	collection.sealer = sealer
 
-			err := collection.createIndex(indexCommand.Name, options, false)
-			if err != nil {
-				fmt.Printf("WARNING: create index '%s': %s\n", indexCommand.Name, err.Error())
-			}
-		case "remove":
-			params := struct {
-				I int
-			}{}
-			json.Unmarshal(command.Payload, &params) // Todo: handle error properly
-			row := collection.Rows[params.I]         // this access is threadsafe, OpenCollection is a secuence
-			err := collection.removeByRow(row, false)
-			if err != nil {
-				fmt.Printf("WARNING: remove row %d: %s\n", params.I, err.Error())
-			}
-		case "patch":
-			params := struct {
-				I    int
-				Diff map[string]interface{}
-			}{}
-			json.Unmarshal(command.Payload, &params)
-			row := collection.Rows[params.I] // this access is threadsafe, OpenCollection is a secuence
-			err := collection.patchByRow(row, params.Diff, false)
-			if err != nil {
-				fmt.Printf("WARNING: patch item %d: %s\n", params.I, err.Error())
+	err = collection.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	collection.Recovery, collection.Load, err = collection.replayDeferred(options.Recovery, collection.applyCommand, true)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(collection.Recovery.Corrupted); n > 0 {
+		fmt.Printf("WARNING: %s: %d invalid records skipped\n", filename, n)
+		for _, corrupted := range collection.Recovery.Corrupted {
+			where := filename
+			if corrupted.Segment != "" {
+				where = corrupted.Segment
 			}
-		case "set_defaults":
-			defaults := map[string]any{}
-			json.Unmarshal(command.Payload, &defaults)
-			collection.setDefaults(defaults, false)
+			fmt.Printf("WARNING: %s: invalid record at byte %d (%d bytes): %s\n", where, corrupted.Offset, corrupted.Length, corrupted.Error)
 		}
 	}
 
 	// Open file for append only
 	// todo: investigate O_SYNC
-	collection.file, err = os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	active := collection.journalFiles()
+	activeFilename := active[len(active)-1]
+	collection.file, err = os.OpenFile(activeFilename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
 	if err != nil {
 		return nil, fmt.Errorf("open file for write: %w", err)
 	}
+	if info, err := collection.file.Stat(); err == nil {
+		collection.segmentBytes = info.Size()
+	}
 
-	collection.buffer = bufio.NewWriterSize(collection.file, 512*1024)
+	collection.buffer = bufio.NewWriterSize(collection.journalWriter(collection.file), 512*1024)
 
 	go func() {
 		for range time.Tick(10 * time.Second) {
@@ -191,7 +238,9 @@ func OpenCollection(filename string) (*Collection, error) {
 			}
 			collection.lastFlushCounter = collection.lastWritesCounter
 			log.Println("FLUSH:", collection.Filename, n)
+			collection.encoderMutex.Lock() // buffer might be swapped by a compaction
 			err := collection.buffer.Flush()
+			collection.encoderMutex.Unlock()
 			if err != nil {
 				log.Println("ERROR: flush buffer:", err.Error())
 			}
@@ -201,80 +250,299 @@ func OpenCollection(filename string) (*Collection, error) {
 	return collection, nil
 }
 
-func (c *Collection) addRow(payload json.RawMessage) (*Row, error) {
+// Options returns the options the collection was opened with
+func (c *Collection) Options() *Options {
+	return c.options
+}
+
+func newCollection(filename string, options *Options) *Collection {
+
+	collection := &Collection{
+		Rows:         []*Row{},
+		rowsById:     map[int64]*Row{},
+		rowsMutex:    &sync.Mutex{},
+		Filename:     filename,
+		indexes:      map[string]*collectionIndex{},
+		indexesMutex: &sync.RWMutex{},
+		encoderMutex: &sync.Mutex{},
+		commitMutex:  &sync.RWMutex{},
+		compactMutex: &sync.Mutex{},
+		syncMutex:    &sync.Mutex{},
+		options:      options,
+
+		sequences:      map[string]int64{},
+		sequencesMutex: &sync.Mutex{},
+	}
+	collection.syncCond = sync.NewCond(collection.syncMutex)
+
+	return collection
+}
+
+// applyCommand replays a journal command into memory
+func (c *Collection) applyCommand(command *Command) error {
+
+	switch command.Name {
+	case "insert":
+		id := command.RowId
+		if id == 0 {
+			id = c.lastRowId + 1 // legacy journal: ids are assigned in insertion order
+		}
+		row, err := c.addRow(id, command.Payload, nil)
+		if err != nil {
+			return err
+		}
+		if command.Revision > 0 {
+			row.Revision = command.Revision // snapshot of a patched row
+		}
+		for name, value := range command.Sequences {
+			c.raiseSequence(name, value)
+		}
+	case "set_sequence":
+		setSequenceCommand := &SetSequenceCommand{}
+		json.Unmarshal(command.Payload, setSequenceCommand) // Todo: handle error properly
+		c.setSequence(setSequenceCommand.Name, setSequenceCommand.Value)
+	case "drop_index":
+		dropIndexCommand := &DropIndexCommand{}
+		json.Unmarshal(command.Payload, dropIndexCommand) // Todo: handle error properly
+
+		err := c.dropIndex(dropIndexCommand.Name, false)
+		if err != nil {
+			fmt.Printf("WARNING: drop index '%s': %s\n", dropIndexCommand.Name, err.Error())
+			// TODO: stop process? if error might get inconsistent state
+		}
+	case "index": // todo: rename to create_index
+		indexCommand := &CreateIndexCommand{}
+		json.Unmarshal(command.Payload, indexCommand) // Todo: handle error properly
+
+		var options interface{}
+
+		switch indexCommand.Type {
+		case "map":
+			options = &IndexMapOptions{}
+			utils.Remarshal(indexCommand.Options, options)
+		case "btree":
+			btreeOptions := &IndexBTreeOptions{}
+			utils.Remarshal(indexCommand.Options, btreeOptions)
+			if indexCommand.Version < indexCommandVersion {
+				btreeOptions.Unique = true
+			}
+			options = btreeOptions
+		default:
+			return fmt.Errorf("index command: unexpected type '%s' instead of [map|btree]", indexCommand.Type)
+		}
+
+		err := c.createIndex(indexCommand.Name, options)
+		if err != nil {
+			fmt.Printf("WARNING: create index '%s': %s\n", indexCommand.Name, err.Error())
+		}
+	case "remove":
+		params := struct {
+			I int
+		}{}
+		json.Unmarshal(command.Payload, &params) // Todo: handle error properly
+		row := c.commandRow(command.RowId, params.I)
+		if row == nil {
+			fmt.Printf("WARNING: remove row %d (i=%d): row does not exist\n", command.RowId, params.I)
+			return nil
+		}
+		err := c.removeByRow(row, 0, false)
+		if err != nil {
+			fmt.Printf("WARNING: remove row %d: %s\n", row.Id, err.Error())
+		}
+	case "patch":
+		params := struct {
+			I    int
+			Diff map[string]interface{}
+		}{}
+		utils.DecodeJSON(command.Payload, &params)
+		row := c.commandRow(command.RowId, params.I)
+		if row == nil {
+			fmt.Printf("WARNING: patch item %d (i=%d): row does not exist\n", command.RowId, params.I)
+			return nil
+		}
+		err := c.patchByRow(row, params.Diff, 0, false)
+		if err != nil {
+			fmt.Printf("WARNING: patch item %d: %s\n", row.Id, err.Error())
+		}
+	case "replace":
+		row := c.commandRow(command.RowId, 0)
+		if row == nil {
+			fmt.Printf("WARNING: replace row %d: row does not exist\n", command.RowId)
+			return nil
+		}
+		err := lockBlock(c.indexesMutex, func() error {
+			return c.replacePayload(row, command.Payload)
+		})
+		if err != nil {
+			fmt.Printf("WARNING: replace row %d: %s\n", row.Id, err.Error())
+		}
+	case "set_defaults":
+		defaults := map[string]any{}
+		utils.DecodeJSON(command.Payload, &defaults)
+		c.setDefaults(defaults, false)
+	case "set_compression":
+		params := struct {
+			Compression string
+		}{}
+		json.Unmarshal(command.Payload, &params)
+		err := c.setCompression(params.Compression, false)
+		if err != nil {
+			fmt.Printf("WARNING: set compression: %s\n", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// commandRow finds the row referenced by a journal command, by id or by
+// position for commands written by older versions
+func (c *Collection) commandRow(id int64, i int) *Row {
+
+	c.rowsMutex.Lock()
+	defer c.rowsMutex.Unlock()
+
+	if id > 0 {
+		return c.rowsById[id]
+	}
+
+	if i < 0 || i >= len(c.Rows) {
+		return nil
+	}
+	return c.Rows[i]
+}
+
+// addRow publishes a new row and journals command (if any) before any other
+// write of the row
+func (c *Collection) addRow(id int64, payload json.RawMessage, command *Command) (*Row, error) {
 
 	row := &Row{
-		Payload: payload,
+		Id:       id,
+		Payload:  payload,
+		Revision: 1,
 	}
 
-	err := indexInsert(c.Indexes, row)
+	row.writeMutex.Lock()
+	defer row.writeMutex.Unlock()
+
+	// indexes are not safe for concurrent writes
+	err := lockBlock(c.indexesMutex, func() error {
+		if !c.deferIndexes {
+			err := indexInsert(c.indexes, row)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.rowsMutex.Lock()
+		row.I = len(c.Rows)
+		c.Rows = append(c.Rows, row)
+		c.rowsById[id] = row
+		if id > c.lastRowId {
+			c.lastRowId = id
+		}
+		c.rowsMutex.Unlock()
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	c.rowsMutex.Lock()
-	row.I = len(c.Rows)
-	c.Rows = append(c.Rows, row)
-	c.rowsMutex.Unlock()
+	if command != nil {
+		err := c.writeCommand(command)
+		if err != nil {
+			c.dropRow(row)
+			return nil, err
+		}
+	}
 
 	return row, nil
 }
 
+// dropRow removes a row from the indexes and from the rows
+func (c *Collection) dropRow(row *Row) error {
+
+	c.indexesMutex.Lock()
+	defer c.indexesMutex.Unlock()
+
+	if !c.deferIndexes {
+		err := indexRemove(c.indexes, row)
+		if err != nil {
+			return fmt.Errorf("could not free index")
+		}
+	}
+
+	c.rowsMutex.Lock()
+	defer c.rowsMutex.Unlock()
+
+	i := row.I
+	last := len(c.Rows) - 1
+	c.Rows[i] = c.Rows[last]
+	c.Rows[i].I = i
+	c.Rows = c.Rows[:last]
+	delete(c.rowsById, row.Id)
+
+	return nil
+}
+
 // TODO: test concurrency
 func (c *Collection) Insert(item map[string]any) (*Row, error) {
-	if c.file == nil {
+	if c.closed() {
 		return nil, fmt.Errorf("collection is closed")
 	}
 
-	auto := atomic.AddInt64(&c.Count, 1)
-
-	if c.Defaults != nil {
-		// item := map[string]any{} // todo: item is shadowed, choose a better name
-		// err := json.Unmarshal(payload, &item)
-		// if err != nil {
-		// 	return nil, fmt.Errorf("json encode defaults: %w", err)
-		// }
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
 
-		for k, v := range c.Defaults {
-			if item[k] != nil {
-				continue
-			}
-			var value any
-			switch v {
-			case "uuid()":
-				value = uuid.NewString()
-			case "unixnano()":
-				value = time.Now().UnixNano()
-			case "auto()":
-				value = auto
-			default:
-				value = v
-			}
-			item[k] = value
-		}
+	if c.options.RevisionField != "" {
+		delete(item, c.options.RevisionField) // not part of the document
 	}
 
-	payload, err := json.Marshal(item)
+	generated, err := c.applyDefaults(item) // sequences are taken below
 	if err != nil {
-		return nil, fmt.Errorf("json encode payload: %w", err)
+		return nil, err
 	}
 
 	// Add row
-	row, err := c.addRow(payload)
-	if err != nil {
-		return nil, err
-	}
+	c.rowsMutex.Lock()
+	c.lastRowId++
+	id := c.lastRowId
+	c.rowsMutex.Unlock()
 
-	// Persist
-	command := &Command{
-		Name:      "insert",
-		Uuid:      uuid.New().String(),
-		Timestamp: time.Now().UnixNano(),
-		StartByte: 0,
-		Payload:   payload,
+	var row *Row
+	var payload json.RawMessage
+	var sequences map[string]int64
+	for attempt := 1; ; attempt++ {
+		sequences, err = c.takeSequences(item, generated)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("json encode payload: %w", err)
+		}
+
+		command := &Command{
+			Name:      "insert",
+			Uuid:      uuid.New().String(),
+			Timestamp: time.Now().UnixNano(),
+			StartByte: 0,
+			RowId:     id,
+			Sequences: sequences,
+			Payload:   payload,
+		}
+
+		row, err = c.addRow(id, payload, command)
+		if attempt < maxGeneratedAttempts && c.generatedConflict(err, generated) {
+			continue // value already taken, try the next one
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
 	}
 
-	err = c.EncodeCommand(command)
+	err = c.commitCommand()
 	if err != nil {
 		return nil, err
 	}
@@ -318,19 +586,36 @@ type CreateIndexCommand struct {
 	Name    string      `json:"name"`
 	Type    string      `json:"type"`
 	Options interface{} `json:"options"`
+	Version int         `json:"version,omitempty"` // see indexCommandVersion
 }
 
+// indexCommandVersion is written in new index commands. Btree indexes from
+// older commands (without version) are unique whatever their options say, as
+// btree indexes used to be.
+const indexCommandVersion = 2
+
 func (c *Collection) SetDefaults(defaults map[string]any) error {
 	return c.setDefaults(defaults, true)
 }
 
 func (c *Collection) setDefaults(defaults map[string]any, persist bool) error {
 
+	if persist {
+		c.commitMutex.RLock()
+		defer c.commitMutex.RUnlock()
+	}
+
+	defaultValues, err := compileDefaults(defaults, !persist)
+	if err != nil {
+		return err
+	}
 	c.Defaults = defaults
+	c.defaultValues = defaultValues
 
 	if !persist {
-		return nil
+		return nil // sequences are raised once the journal is replayed
 	}
+	c.raiseSequencesToRows()
 
 	payload, err := json.Marshal(defaults)
 	if err != nil {
@@ -348,66 +633,94 @@ func (c *Collection) setDefaults(defaults map[string]any, persist bool) error {
 	return c.EncodeCommand(command)
 }
 
-// IndexMap create a unique index with a name
-// Constraints: values can be only scalar strings or array of strings
+// Index creates an index with a name and waits until it is built, rows can be
+// written meanwhile. See IndexBackground.
 func (c *Collection) Index(name string, options interface{}) error { // todo: rename to CreateIndex
-	return c.createIndex(name, options, true)
-}
 
-func (c *Collection) createIndex(name string, options interface{}, persist bool) error {
-
-	if _, exists := c.Indexes[name]; exists {
-		return fmt.Errorf("index '%s' already exists", name)
+	index, err := c.startIndex(name, options)
+	if err != nil {
+		return err
 	}
+	<-index.done
 
-	index := &collectionIndex{}
+	c.indexesMutex.Lock()
+	defer c.indexesMutex.Unlock()
 
-	switch value := options.(type) {
-	case *IndexMapOptions:
-		index.Type = "map"
-		index.Index = NewIndexSyncMap(value)
-		index.Options = value
-	case *IndexBTreeOptions:
-		index.Type = "btree"
-		index.Index = NewIndexBTree(value)
-		index.Options = value
-	default:
-		return fmt.Errorf("unexpected options parameters, it should be [map|btree]")
+	if c.indexes[name] != index {
+		return fmt.Errorf("index '%s' dropped while building", name)
+	}
+	if index.state == IndexFailed {
+		delete(c.indexes, name)
+		return index.err
 	}
 
-	c.Indexes[name] = index
+	return nil
+}
 
-	// Add all rows to the index
-	for _, row := range c.Rows {
-		err := index.AddRow(row)
-		if err != nil {
-			delete(c.Indexes, name)
-			return fmt.Errorf("index row: %s, data: %s", err.Error(), string(row.Payload))
-		}
-	}
+// createIndex replays an index command
+func (c *Collection) createIndex(name string, options interface{}) error {
 
-	if !persist {
-		return nil
+	c.indexesMutex.Lock()
+	defer c.indexesMutex.Unlock()
+
+	if _, exists := c.indexes[name]; exists {
+		return fmt.Errorf("index '%s' already exists", name)
 	}
 
-	payload, err := json.Marshal(&CreateIndexCommand{
-		Name:    name,
-		Type:    index.Type,
-		Options: options,
-	})
+	index, err := newCollectionIndex(options)
 	if err != nil {
-		return fmt.Errorf("json encode payload: %w", err)
+		return err
 	}
+	index.state = IndexReady
 
-	command := &Command{
-		Name:      "index", // todo: rename to create_index
-		Uuid:      uuid.New().String(),
-		Timestamp: time.Now().UnixNano(),
-		StartByte: 0,
-		Payload:   payload,
+	// Add all rows to the index, unless rows are indexed in bulk later
+	if !c.deferIndexes {
+		for _, row := range c.Rows {
+			err := index.AddRow(row)
+			if err != nil {
+				return fmt.Errorf("index row: %s, data: %s", err.Error(), string(row.Payload))
+			}
+		}
 	}
 
-	return c.EncodeCommand(command)
+	c.indexes[name] = index
+
+	return nil
+}
+
+// ErrDuplicateKey is matched (errors.Is) by the index errors of a key already
+// taken by another row
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// duplicateKeyError keeps the message of the index and matches ErrDuplicateKey
+type duplicateKeyError struct {
+	message string
+}
+
+func newDuplicateKeyError(format string, a ...interface{}) error {
+	return &duplicateKeyError{message: fmt.Sprintf(format, a...)}
+}
+
+func (e *duplicateKeyError) Error() string {
+	return e.message
+}
+
+func (e *duplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+// IndexConflictError is returned when a document is rejected by an index
+type IndexConflictError struct {
+	Index string
+	Err   error
+}
+
+func (e *IndexConflictError) Error() string {
+	return fmt.Sprintf("index add '%s': %s", e.Index, e.Err.Error())
+}
+
+func (e *IndexConflictError) Unwrap() error {
+	return e.Err
 }
 
 func indexInsert(indexes map[string]*collectionIndex, row *Row) (err error) {
@@ -428,9 +741,13 @@ func indexInsert(indexes map[string]*collectionIndex, row *Row) (err error) {
 	}()
 
 	for key, index := range indexes {
+		if index.state != IndexReady {
+			index.touch(row)
+			continue
+		}
 		err = index.AddRow(row)
 		if err != nil {
-			return fmt.Errorf("index add '%s': %s", key, err.Error())
+			return &IndexConflictError{Index: key, Err: err}
 		}
 
 		rollbacks[c] = index
@@ -442,6 +759,10 @@ func indexInsert(indexes map[string]*collectionIndex, row *Row) (err error) {
 
 func indexRemove(indexes map[string]*collectionIndex, row *Row) (err error) {
 	for key, index := range indexes {
+		if index.state != IndexReady {
+			index.touch(row)
+			continue
+		}
 		err = index.RemoveRow(row)
 		if err != nil {
 			// TODO: does this make any sense?
@@ -453,36 +774,50 @@ func indexRemove(indexes map[string]*collectionIndex, row *Row) (err error) {
 }
 
 func (c *Collection) Remove(r *Row) error {
-	return c.removeByRow(r, true)
+	return c.removeByRow(r, 0, true)
 }
 
 // TODO: move this to utils/diogenesis?
-func lockBlock(m *sync.Mutex, f func() error) error {
+func lockBlock(m sync.Locker, f func() error) error {
 	m.Lock()
 	defer m.Unlock()
 	return f()
 }
 
-func (c *Collection) removeByRow(row *Row, persist bool) error { // todo: rename to 'removeRow'
+func (c *Collection) removeByRow(row *Row, revision int64, persist bool) error { // todo: rename to 'removeRow'
+
+	if persist {
+		c.commitMutex.RLock()
+		defer c.commitMutex.RUnlock()
+	}
+
+	row.writeMutex.Lock()
+	defer row.writeMutex.Unlock()
 
-	var i int
 	err := lockBlock(c.rowsMutex, func() error {
-		i = row.I
-		if len(c.Rows) <= i {
-			return fmt.Errorf("row %d does not exist", i)
+		if c.rowsById[row.Id] != row {
+			return fmt.Errorf("row %d does not exist", row.Id)
 		}
+		return checkRevision(row, revision)
+	})
+	if err != nil {
+		return err
+	}
 
-		err := indexRemove(c.Indexes, row)
+	if persist {
+		err := c.writeCommand(&Command{
+			Name:      "remove",
+			Uuid:      uuid.New().String(),
+			Timestamp: time.Now().UnixNano(),
+			StartByte: 0,
+			RowId:     row.Id,
+		})
 		if err != nil {
-			return fmt.Errorf("could not free index")
+			return err
 		}
+	}
 
-		last := len(c.Rows) - 1
-		c.Rows[i] = c.Rows[last]
-		c.Rows[i].I = i
-		c.Rows = c.Rows[:last]
-		return nil
-	})
+	err = c.dropRow(row)
 	if err != nil {
 		return err
 	}
@@ -491,33 +826,18 @@ func (c *Collection) removeByRow(row *Row, persist bool) error { // todo: rename
 		return nil
 	}
 
-	// Persist
-	payload, err := json.Marshal(map[string]interface{}{
-		"i": i,
-	})
-	if err != nil {
-		return err // todo: wrap error
-	}
-	command := &Command{
-		Name:      "remove",
-		Uuid:      uuid.New().String(),
-		Timestamp: time.Now().UnixNano(),
-		StartByte: 0,
-		Payload:   payload,
-	}
-
-	return c.EncodeCommand(command)
+	return c.commitCommand()
 }
 
 func (c *Collection) Patch(row *Row, patch interface{}) error {
-	return c.patchByRow(row, patch, true)
+	return c.patchByRow(row, patch, 0, true)
 }
 
-func (c *Collection) patchByRow(row *Row, patch interface{}, persist bool) error { // todo: rename to 'patchRow'
+func (c *Collection) patchByRow(row *Row, patch interface{}, revision int64, persist bool) error { // todo: rename to 'patchRow'
 
-	originalValue, err := decodeJSONValue(row.Payload)
-	if err != nil {
-		return fmt.Errorf("decode row payload: %w", err)
+	if persist {
+		c.commitMutex.RLock()
+		defer c.commitMutex.RUnlock()
 	}
 
 	normalizedPatch, err := normalizeJSONValue(patch)
@@ -525,59 +845,247 @@ func (c *Collection) patchByRow(row *Row, patch interface{}, persist bool) error
 		return fmt.Errorf("normalize patch: %w", err)
 	}
 
-	newValue, changed, err := applyMergePatchValue(originalValue, normalizedPatch)
-	if err != nil {
-		return fmt.Errorf("cannot apply patch: %w", err)
+	_, jsonPatch := normalizedPatch.([]interface{}) // operation list
+	apply := mergePatchFunction(normalizedPatch)
+	if persist { // replayed diffs are always merge patches
+		apply, err = patchFunction(normalizedPatch)
+		if err != nil {
+			return err
+		}
+		apply = c.withOnUpdate(apply)
 	}
 
-	if !changed {
+	for {
+		err := checkRevision(row, revision) // fail fast, checked again under the index lock
+		if err != nil {
+			return err
+		}
+
+		c.indexesMutex.RLock()
+		base, payload := atomic.LoadInt64(&row.Revision), row.Payload
+		c.indexesMutex.RUnlock()
+
+		newPayload, diffValue, err := c.patchPayload(payload, apply)
+		if err != nil {
+			return err
+		}
+		if newPayload == nil {
+			return nil // unchanged
+		}
+
+		if c.deferIndexes {
+			row.Payload = newPayload
+			row.Revision++
+			return nil // indexed in bulk later, replayed patches are not persisted
+		}
+
+		var command *Command
+		if persist && (jsonPatch || diffValue == nil) {
+			command = &Command{
+				Name:      "replace", // the resulting document, a merge diff cannot set nulls
+				Uuid:      uuid.New().String(),
+				Timestamp: time.Now().UnixNano(),
+				StartByte: 0,
+				RowId:     row.Id,
+				Payload:   newPayload,
+			}
+		} else if persist {
+			diff, err := json.Marshal(map[string]interface{}{
+				"diff": diffValue,
+			})
+			if err != nil {
+				return err // todo: wrap error
+			}
+			command = &Command{
+				Name:      "patch",
+				Uuid:      uuid.New().String(),
+				Timestamp: time.Now().UnixNano(),
+				StartByte: 0,
+				RowId:     row.Id,
+				Payload:   diff,
+			}
+		}
+
+		applied, err := c.swapPayload(row, newPayload, base, revision, command)
+		if err != nil {
+			return err
+		}
+		if applied {
+			break
+		}
+		// patched meanwhile, apply again on top of the new version
+	}
+
+	if !persist {
 		return nil
 	}
 
-	newPayload, err := json.Marshal(newValue)
+	return c.commitCommand()
+}
+
+// patchFunction returns the function that applies a patch to a document: an
+// RFC 6902 JSON Patch (operation list), update operators ($inc, $push...) or a
+// merge patch
+func patchFunction(patch interface{}) (func(original interface{}) (interface{}, bool, error), error) {
+
+	operations, err := jsonPatchOperations(patch)
 	if err != nil {
-		return fmt.Errorf("marshal payload: %w", err)
+		return nil, err
+	}
+	if operations != nil {
+		return func(original interface{}) (interface{}, bool, error) {
+			return applyJSONPatch(original, operations)
+		}, nil
 	}
 
-	// index update
-	err = indexRemove(c.Indexes, row)
+	operators, err := updateOperators(patch)
 	if err != nil {
-		return fmt.Errorf("indexRemove: %w", err)
+		return nil, err
+	}
+	if operators != nil {
+		return func(original interface{}) (interface{}, bool, error) {
+			return applyUpdateOperators(original, operators)
+		}, nil
 	}
 
-	row.Payload = newPayload
+	return mergePatchFunction(patch), nil
+}
 
-	err = indexInsert(c.Indexes, row)
+func mergePatchFunction(patch interface{}) func(original interface{}) (interface{}, bool, error) {
+	return func(original interface{}) (interface{}, bool, error) {
+		return applyMergePatchValue(original, patch)
+	}
+}
+
+// patchPayload applies a patch function to a payload, it returns the new
+// payload (nil if it does not change) and the diff to journal, nil if only
+// the new payload can be journaled
+func (c *Collection) patchPayload(payload json.RawMessage, apply func(original interface{}) (interface{}, bool, error)) (json.RawMessage, interface{}, error) {
+
+	originalValue, err := decodeJSONValue(payload)
 	if err != nil {
-		return fmt.Errorf("indexInsert: %w", err)
+		return nil, nil, fmt.Errorf("decode row payload: %w", err)
 	}
 
-	if !persist {
-		return nil
+	newValue, changed, err := apply(originalValue)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot apply patch: %w", err)
+	}
+
+	if !changed {
+		return nil, nil, nil
+	}
+
+	if field := c.options.RevisionField; field != "" {
+		keepField(originalValue, newValue, field) // not part of the document
 	}
 
 	diffValue, hasDiff := createMergeDiff(originalValue, newValue)
 	if !hasDiff {
-		return nil
+		return nil, nil, nil
+	}
+
+	newPayload, err := json.Marshal(newValue)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal payload: %w", err)
+	}
+
+	if hasNullMember(newValue) {
+		return newPayload, nil, nil
+	}
+
+	return newPayload, diffValue, nil
+}
+
+// swapPayload replaces the payload of a row and its index entries, all or
+// nothing, and journals command. It is not applied if the row is no longer at
+// base. The indexes are locked only to swap the entries of the row, its write
+// lock keeps the journal in order.
+func (c *Collection) swapPayload(row *Row, newPayload json.RawMessage, base, revision int64, command *Command) (bool, error) {
+
+	row.writeMutex.Lock()
+	defer row.writeMutex.Unlock()
+
+	if !c.isLive(row) {
+		return false, fmt.Errorf("row %d does not exist", row.Id)
+	}
+	err := checkRevision(row, revision)
+	if err != nil {
+		return false, err
+	}
+	if atomic.LoadInt64(&row.Revision) != base {
+		return false, nil
 	}
 
-	// Persist
-	payload, err := json.Marshal(map[string]interface{}{
-		"i":    row.I,
-		"diff": diffValue,
+	oldPayload := row.Payload
+	err = lockBlock(c.indexesMutex, func() error {
+		return c.replacePayload(row, newPayload)
 	})
+	if err != nil || command == nil {
+		return err == nil, err
+	}
+
+	err = c.writeCommand(command)
 	if err != nil {
-		return err // todo: wrap error
+		restoreErr := lockBlock(c.indexesMutex, func() error {
+			return c.replacePayload(row, oldPayload)
+		})
+		if restoreErr != nil {
+			return false, fmt.Errorf("restore payload: %w", restoreErr)
+		}
+		return false, err
 	}
-	command := &Command{
-		Name:      "patch",
-		Uuid:      uuid.New().String(),
-		Timestamp: time.Now().UnixNano(),
-		StartByte: 0,
-		Payload:   payload,
+
+	return true, nil
+}
+
+// replacePayload sets the payload of a row and its index entries, all or
+// nothing, and increases its revision. indexesMutex must be held (W).
+func (c *Collection) replacePayload(row *Row, newPayload json.RawMessage) error {
+
+	if c.deferIndexes {
+		row.Payload = newPayload
+		atomic.AddInt64(&row.Revision, 1)
+		return nil // indexed in bulk later
 	}
 
-	return c.EncodeCommand(command)
+	err := indexRemove(c.indexes, row)
+	if err != nil {
+		return fmt.Errorf("indexRemove: %w", err)
+	}
+
+	oldPayload := row.Payload
+	row.Payload = newPayload
+
+	err = indexInsert(c.indexes, row)
+	if err != nil {
+		row.Payload = oldPayload
+		restoreErr := indexInsert(c.indexes, row)
+		if restoreErr != nil {
+			return fmt.Errorf("restore indexes: %w", restoreErr)
+		}
+		return err
+	}
+	atomic.AddInt64(&row.Revision, 1)
+
+	return nil
+}
+
+// keepField leaves a top level field of modified as it is in original
+func keepField(original, modified interface{}, field string) {
+
+	modifiedMap, ok := modified.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if originalMap, ok := original.(map[string]interface{}); ok {
+		if value, exists := originalMap[field]; exists {
+			modifiedMap[field] = value
+			return
+		}
+	}
+	delete(modifiedMap, field)
 }
 
 func decodeJSONValue(raw json.RawMessage) (interface{}, error) {
@@ -587,7 +1095,7 @@ func decodeJSONValue(raw json.RawMessage) (interface{}, error) {
 	}
 
 	var value interface{}
-	if err := json.Unmarshal(raw, &value); err != nil {
+	if err := utils.DecodeJSON(raw, &value); err != nil {
 		return nil, err
 	}
 	return value, nil
@@ -598,7 +1106,7 @@ func normalizeJSONValue(value interface{}) (interface{}, error) {
 	switch v := value.(type) {
 	case json.RawMessage:
 		var decoded interface{}
-		if err := json.Unmarshal(v, &decoded); err != nil {
+		if err := utils.DecodeJSON(v, &decoded); err != nil {
 			return nil, err
 		}
 		return normalizeJSONValue(decoded)
@@ -623,10 +1131,55 @@ func normalizeJSONValue(value interface{}) (interface{}, error) {
 		}
 		return normalized, nil
 	default:
+		if number, ok := utils.ToNumber(v); ok {
+			return number, nil // same type as a decoded payload
+		}
 		return v, nil
 	}
 }
 
+// equalJSONValues is reflect.DeepEqual with numbers compared by value, so
+// 1 equals 1.0
+func equalJSONValues(a, b interface{}) bool {
+
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, item := range x {
+			other, exists := y[key]
+			if !exists || !equalJSONValues(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSONValues(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if x, ok := utils.ToNumber(a); ok {
+		y, ok := utils.ToNumber(b)
+		if !ok {
+			return false
+		}
+		cmp, err := utils.CompareNumbers(x, y)
+		return err == nil && cmp == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
 func applyMergePatchValue(original interface{}, patch interface{}) (interface{}, bool, error) {
 
 	switch p := patch.(type) {
@@ -805,7 +1358,25 @@ func cloneJSONArray(values []interface{}) []interface{} {
 	return cloned
 }
 
+// closed tells if the journal is closed (or read only)
+func (c *Collection) closed() bool {
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+	return c.file == nil
+}
+
 func (c *Collection) Close() error {
+
+	c.compactMutex.Lock()
+	defer c.compactMutex.Unlock()
+
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+
+	if c.file == nil {
+		return nil // already closed or read only
+	}
+
 	{
 		err := c.buffer.Flush()
 		if err != nil {
@@ -824,6 +1395,23 @@ func (c *Collection) Drop() error {
 		return fmt.Errorf("close: %w", err)
 	}
 
+	for _, filename := range c.journalFiles() {
+		if filename == c.Filename {
+			continue
+		}
+		err = os.Remove(filename)
+		if err != nil {
+			return fmt.Errorf("remove: %w", err)
+		}
+	}
+
+	if c.manifest != nil {
+		err = os.Remove(c.Filename + manifestSuffix)
+		if err != nil {
+			return fmt.Errorf("remove: %w", err)
+		}
+	}
+
 	err = os.Remove(c.Filename)
 	if err != nil {
 		return fmt.Errorf("remove: %w", err)
@@ -841,14 +1429,23 @@ type DropIndexCommand struct {
 }
 
 func (c *Collection) dropIndex(name string, persist bool) error {
-	_, exists := c.Indexes[name]
+
+	if persist {
+		c.commitMutex.RLock()
+		defer c.commitMutex.RUnlock()
+	}
+	c.indexesMutex.Lock()
+	index, exists := c.indexes[name]
+	if exists {
+		delete(c.indexes, name)
+	}
+	c.indexesMutex.Unlock()
 	if !exists {
 		return fmt.Errorf("dropIndex: index '%s' not found", name)
 	}
-	delete(c.Indexes, name)
 
-	if !persist {
-		return nil
+	if !persist || index.state != IndexReady {
+		return nil // indexes are persisted once built
 	}
 
 	payload, err := json.Marshal(&CreateIndexCommand{
@@ -871,23 +1468,65 @@ func (c *Collection) dropIndex(name string, persist bool) error {
 
 func (c *Collection) EncodeCommand(command *Command) error {
 
+	err := c.writeCommand(command)
+	if err != nil {
+		return err
+	}
+
+	return c.commitCommand()
+}
+
+// writeCommand appends a command to the journal buffer. Writes call it inside
+// the critical section that applies the command in memory, so the journal
+// keeps the order in which changes become visible.
+func (c *Collection) writeCommand(command *Command) error {
+
 	atomic.AddInt64(&c.lastWritesCounter, 1)
 
 	em := encPool.Get().(*EncoderMachine)
 	defer encPool.Put(em)
-	em.Buffer.Reset()
 
-	// err := em.Enc.Encode(command)
-	err := json2.MarshalEncode(em.Enc2, command)
-	// err := json2.MarshalWrite(em.Buffer, command)
+	b, err := encodeCommandLine(em, command)
 	if err != nil {
 		return err
 	}
 
-	b := em.Buffer.Bytes()
 	c.encoderMutex.Lock()
-	c.buffer.Write(b)
+	if c.file == nil {
+		c.encoderMutex.Unlock()
+		return fmt.Errorf("collection is closed")
+	}
+	if len(b) > maxFrameData && (c.compression() != CompressionNone || c.sealer != nil) {
+		c.encoderMutex.Unlock()
+		return fmt.Errorf("command of %d bytes exceeds the maximum frame size", len(b))
+	}
+	_, err = c.buffer.Write(b)
 	//	c.file.Write(b)
+	if c.compactPending != nil {
+		c.compactPending.Write(b)
+	}
+	c.writtenSeq++
+	c.segmentBytes += int64(len(b))
+	if err == nil && c.shouldRotate() {
+		rotateErr := c.rotate()
+		if rotateErr != nil {
+			log.Println("ERROR: rotate journal:", c.Filename, rotateErr.Error())
+		}
+	}
 	c.encoderMutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
 	return nil
 }
+
+// commitCommand runs after a command is written: it may trigger an automatic
+// compaction and waits for the durability of the collection. Call it once the
+// row and index locks are released, it can block on fsync.
+func (c *Collection) commitCommand() error {
+
+	c.maybeAutoCompact()
+
+	return c.Commit(c.options.Durability)
+}
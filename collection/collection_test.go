@@ -62,6 +62,35 @@ func TestCollection_Insert_Concurrency(t *testing.T) {
 	})
 }
 
+func TestCollection_Insert_ConcurrencyUnique(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.Index("by-code", &IndexBTreeOptions{Fields: []string{"code"}, Unique: true})
+		c.Index("by-name", &IndexMapOptions{Field: "name"})
+
+		// Run
+		wg := &sync.WaitGroup{}
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					c.Insert(map[string]interface{}{"code": i, "name": strconv.Itoa(i)})
+					c.Insert(map[string]interface{}{"code": 1000 + i, "name": strconv.Itoa(i)})
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Check
+		AssertEqual(len(c.Rows), 100)
+		AssertEqual(c.indexes["by-code"].Index.(*IndexBtree).Btree.Len(), 100)
+	})
+}
+
 func TestFindOne(t *testing.T) {
 	Environment(func(filename string) {
 
@@ -114,7 +143,7 @@ func TestIndex(t *testing.T) {
 
 		// Check
 		user := &User{}
-		c.Indexes["my-index"].Traverse([]byte(`{"value":"2"}`), func(row *Row) bool {
+		c.indexes["my-index"].Traverse([]byte(`{"value":"2"}`), func(row *Row) bool {
 			json.Unmarshal(row.Payload, &user)
 			return false
 		})
@@ -149,7 +178,7 @@ func TestInsertAfterIndex(t *testing.T) {
 
 		// Check
 		user := &User{}
-		findByIndex(c.Indexes["my-index"], `{"value":"1"}`, user)
+		findByIndex(c.indexes["my-index"], `{"value":"1"}`, user)
 		AssertEqual(user.Name, "Pablo")
 	})
 }
@@ -174,7 +203,7 @@ func TestIndexMultiValue(t *testing.T) {
 		// Check
 		AssertNil(indexErr)
 		u := &User{}
-		findByIndex(c.Indexes["my-index"], `{"value":"p18@yahoo.com"}`, u)
+		findByIndex(c.indexes["my-index"], `{"value":"p18@yahoo.com"}`, u)
 		AssertEqual(u.Id, newUser.Id)
 	})
 }
@@ -198,7 +227,7 @@ func TestIndexSparse(t *testing.T) {
 		AssertNotNil(row)
 		AssertNil(err)
 
-		index := c.Indexes["my-index"].Index
+		index := c.indexes["my-index"].Index
 		if i, ok := index.(*IndexMap); ok {
 			AssertEqual(len(i.Entries), 0)
 		}
@@ -275,7 +304,7 @@ func TestPersistenceInsertAndIndex(t *testing.T) {
 			Name  string
 			Email []string
 		}{}
-		findByIndex(c.Indexes["my-index"], `{"value":"sara@email.com"}`, &user)
+		findByIndex(c.indexes["my-index"], `{"value":"sara@email.com"}`, &user)
 
 		// Check
 		AssertEqual(user.Id, "2")
@@ -305,7 +334,7 @@ func TestPersistenceDelete(t *testing.T) {
 			Name  string
 			Email []string
 		}{}
-		n := findByIndex(c.Indexes["my-index"], `{"value":"sara@email.com"}`, &user)
+		n := findByIndex(c.indexes["my-index"], `{"value":"sara@email.com"}`, &user)
 
 		// Check
 		AssertEqual(n, 0)
@@ -355,7 +384,7 @@ func TestPersistenceUpdate(t *testing.T) {
 			Name  string
 			Email []string
 		}{}
-		n := findByIndex(c.Indexes["my-index"], `{"value":"1"}`, &user)
+		n := findByIndex(c.indexes["my-index"], `{"value":"1"}`, &user)
 
 		// Check
 		AssertEqual(n, 1)
@@ -400,6 +429,160 @@ func TestPersistenceUpdate_TwiceOptimization(t *testing.T) {
 	})
 }
 
+func TestPersistence_ConcurrentRemoveAndPatch(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		rows := []*Row{}
+		for i := 0; i < 1000; i++ {
+			row, _ := c.Insert(map[string]interface{}{"n": i})
+			rows = append(rows, row)
+		}
+
+		// Run
+		wg := &sync.WaitGroup{}
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < len(rows); i += 4 {
+					if i%2 == 0 {
+						c.Remove(rows[i])
+					} else {
+						c.Patch(rows[i], map[string]interface{}{"patched": true})
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		expected := map[int64]string{}
+		for _, row := range c.Rows {
+			expected[row.Id] = string(row.Payload)
+		}
+		c.Close()
+
+		// Check
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		obtained := map[int64]string{}
+		for _, row := range c.Rows {
+			obtained[row.Id] = string(row.Payload)
+		}
+		AssertEqual(len(obtained), 500)
+		AssertEqual(obtained, expected)
+	})
+}
+
+func TestPersistence_ConcurrentPatchSameRow(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		row, _ := c.Insert(map[string]interface{}{"n": 0})
+
+		// Run
+		wg := &sync.WaitGroup{}
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					c.Patch(row, map[string]interface{}{"n": w*1000 + i})
+				}
+			}(w)
+		}
+		wg.Wait()
+		expected := string(row.Payload)
+		c.Close()
+
+		// Check
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 1)
+		AssertEqual(string(c.Rows[0].Payload), expected)
+	})
+}
+
+func TestPatch_IndexConflictRollback(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Index("by-id", &IndexMapOptions{Field: "id"})
+		c.Index("by-email", &IndexMapOptions{Field: "email"})
+		c.Insert(map[string]interface{}{"id": "1", "email": "ana@email.com"})
+		row, _ := c.Insert(map[string]interface{}{"id": "2", "email": "sara@email.com"})
+
+		// Run
+		err := c.Patch(row, map[string]interface{}{"id": "3", "email": "ana@email.com"})
+
+		// Check
+		conflict := &IndexConflictError{}
+		AssertTrue(errors.As(err, &conflict))
+		AssertEqual(conflict.Index, "by-email")
+		AssertEqual(string(row.Payload), `{"email":"sara@email.com","id":"2"}`)
+		AssertEqual(findByIndex(c.indexes["by-id"], `{"value":"2"}`, &map[string]any{}), 1)
+		AssertEqual(findByIndex(c.indexes["by-id"], `{"value":"3"}`, &map[string]any{}), 0)
+		AssertEqual(findByIndex(c.indexes["by-email"], `{"value":"sara@email.com"}`, &map[string]any{}), 1)
+		_, err = c.Insert(map[string]interface{}{"id": "3", "email": "pablo@email.com"})
+		AssertNil(err)
+		c.Close()
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 3) // the rejected patch is not persisted
+	})
+}
+
+func TestPatch_MandatoryFieldRollback(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.Index("my-index", &IndexMapOptions{Field: "email"})
+		row, _ := c.Insert(map[string]interface{}{"id": "1", "email": "ana@email.com"})
+
+		// Run
+		err := c.Patch(row, map[string]interface{}{"email": nil})
+
+		// Check
+		AssertNotNil(err)
+		AssertEqual(string(row.Payload), `{"email":"ana@email.com","id":"1"}`)
+		AssertEqual(findByIndex(c.indexes["my-index"], `{"value":"ana@email.com"}`, &map[string]any{}), 1)
+	})
+}
+
+func TestPersistence_LegacyPositions(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		os.WriteFile(filename, []byte(`{"name":"insert","uuid":"1","timestamp":1,"start_byte":0,"payload":{"id":"1"}}
+{"name":"insert","uuid":"2","timestamp":2,"start_byte":0,"payload":{"id":"2"}}
+{"name":"insert","uuid":"3","timestamp":3,"start_byte":0,"payload":{"id":"3"}}
+{"name":"remove","uuid":"4","timestamp":4,"start_byte":0,"payload":{"i":0}}
+{"name":"patch","uuid":"5","timestamp":5,"start_byte":0,"payload":{"i":0,"diff":{"name":"Ana"}}}
+`), 0666)
+
+		// Run
+		c, _ := OpenCollection(filename)
+		row, _ := c.Insert(map[string]interface{}{"id": "4"})
+		c.Patch(c.Rows[1], map[string]interface{}{"name": "Sara"})
+		c.Close()
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+
+		// Check
+		AssertEqual(row.Id, int64(4))
+		payloads := []string{}
+		for _, row := range c.Rows {
+			payloads = append(payloads, string(row.Payload))
+		}
+		AssertEqual(payloads, []string{`{"id":"3","name":"Ana"}`, `{"id":"2","name":"Sara"}`, `{"id":"4"}`})
+	})
+}
+
 type MockIndex struct {
 	AddRowCallback    func(row *Row) error
 	RemoveRowCallback func(row *Row) error
@@ -441,12 +624,15 @@ func TestIndexInsert_Rollback(t *testing.T) {
 
 	indexes := map[string]*collectionIndex{
 		"a": &collectionIndex{
+			state: IndexReady,
 			Index: newMock("a"),
 		},
 		"b": &collectionIndex{
+			state: IndexReady,
 			Index: newMock("b"),
 		},
 		"c": &collectionIndex{
+			state: IndexReady,
 			Index: newMock("c"),
 		},
 	}
@@ -463,6 +649,7 @@ func TestIndexInsert_Rollback_BlackBox(t *testing.T) {
 
 	indexes := map[string]*collectionIndex{
 		"a": &collectionIndex{
+			state: IndexReady,
 			Index: NewIndexMap(&IndexMapOptions{
 				Field: "id",
 			}),
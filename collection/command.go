@@ -5,9 +5,12 @@ import (
 )
 
 type Command struct {
-	Name      string          `json:"name"`
-	Uuid      string          `json:"uuid"`
-	Timestamp int64           `json:"timestamp"`
-	StartByte int64           `json:"start_byte"`
-	Payload   json.RawMessage `json:"payload"`
+	Name      string           `json:"name"`
+	Uuid      string           `json:"uuid"`
+	Timestamp int64            `json:"timestamp"`
+	StartByte int64            `json:"start_byte"`
+	RowId     int64            `json:"row_id,omitzero"`     // row affected by insert, patch, replace and remove
+	Revision  int64            `json:"revision,omitzero"`   // revision of a patched row in a snapshot insert
+	Sequences map[string]int64 `json:"sequences,omitempty"` // sequence values taken by an insert
+	Payload   json.RawMessage  `json:"payload"`
 }
@@ -0,0 +1,266 @@
+package collection
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// compactingSuffix is appended to the collection filename while the snapshot
+// is being written, a leftover file means an interrupted compaction
+const compactingSuffix = ".compacting"
+
+type CompactionStats struct {
+	Rows        int           `json:"rows"`
+	Indexes     int           `json:"indexes"`
+	Pending     int64         `json:"pending"` // commands written while compacting
+	BytesBefore int64         `json:"bytes_before"`
+	BytesAfter  int64         `json:"bytes_after"`
+	Start       time.Time     `json:"start"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// IsAuxiliaryFile tells if filename belongs to the internals of a collection
+// instead of being a collection itself
+func IsAuxiliaryFile(filename string) bool {
+	return strings.HasSuffix(filename, compactingSuffix) ||
+		strings.HasSuffix(filename, quarantineSuffix) ||
+		strings.HasSuffix(filename, manifestSuffix) ||
+		isSegmentFile(filename)
+}
+
+// Compact rewrites the journal as a snapshot of the current state: defaults,
+// index definitions and live rows. Writes are only blocked while the snapshot
+// is taken and while the new journal is swapped in.
+func (c *Collection) Compact() (*CompactionStats, error) {
+
+	c.compactMutex.Lock()
+	defer c.compactMutex.Unlock()
+
+	if c.file == nil {
+		return nil, fmt.Errorf("collection is closed")
+	}
+
+	stats := &CompactionStats{
+		Start: time.Now(),
+	}
+
+	stats.BytesBefore = c.JournalSize()
+
+	// Consistent point: no persisted operation is in progress
+	c.commitMutex.Lock()
+	stats.Rows = len(c.Rows)
+	stats.Indexes = len(c.Indexes())
+	commands, err := c.snapshotCommands()
+	if err != nil {
+		c.commitMutex.Unlock()
+		return nil, err
+	}
+	c.encoderMutex.Lock()
+	c.compactPending = &bytes.Buffer{}
+	compression := c.compression()
+	c.encoderMutex.Unlock()
+	compacted := atomic.LoadInt64(&c.commandsSinceCompact) // discounted on success
+	c.commitMutex.Unlock()
+
+	abort := func(err error) (*CompactionStats, error) {
+		c.encoderMutex.Lock()
+		c.compactPending = nil
+		c.encoderMutex.Unlock()
+		return nil, err
+	}
+
+	tmpFilename := c.Filename + compactingSuffix
+	tmp, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return abort(fmt.Errorf("open snapshot file: %w", err))
+	}
+	defer os.Remove(tmpFilename) // no-op once renamed
+
+	em := encPool.Get().(*EncoderMachine)
+	defer encPool.Put(em)
+
+	w := bufio.NewWriterSize(newJournalWriter(tmp, compression, c.sealer), 512*1024)
+	for _, command := range commands {
+		line, err := encodeCommandLine(em, command)
+		if err == nil {
+			_, err = w.Write(line)
+		}
+		if err != nil {
+			tmp.Close()
+			return abort(fmt.Errorf("write snapshot: %w", err))
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		tmp.Close()
+		return abort(fmt.Errorf("flush snapshot: %w", err))
+	}
+
+	// Swap: block writers until the new journal is in place
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+
+	stats.Pending = int64(bytes.Count(c.compactPending.Bytes(), []byte("\n")))
+	_, err = w.Write(c.compactPending.Bytes())
+	c.compactPending = nil
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write snapshot: %w", err)
+	}
+
+	err = c.buffer.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("flush journal: %w", err)
+	}
+
+	var file *os.File
+	if c.manifest == nil {
+		err = os.Rename(tmpFilename, c.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("replace journal: %w", err)
+		}
+		file, err = os.OpenFile(c.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("open file for write: %w", err)
+		}
+	} else {
+		file, err = c.replaceSegments(tmpFilename)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.file.Close()
+	c.file = file
+	c.buffer.Reset(c.journalWriter(file))
+
+	if info, err := file.Stat(); err == nil {
+		stats.BytesAfter = info.Size()
+	}
+	c.segmentBytes = stats.BytesAfter
+	stats.Duration = time.Since(stats.Start)
+	c.LastCompaction = stats
+	atomic.AddInt64(&c.commandsSinceCompact, -compacted)
+
+	return stats, nil
+}
+
+// snapshotCommands builds the minimal list of commands that reproduce the
+// current state. Caller must hold commitMutex.
+func (c *Collection) snapshotCommands() ([]*Command, error) {
+
+	commands := []*Command{}
+	newCommand := func(name string, payload json.RawMessage) {
+		commands = append(commands, &Command{
+			Name:      name,
+			Uuid:      uuid.New().String(),
+			Timestamp: time.Now().UnixNano(),
+			StartByte: 0,
+			Payload:   payload,
+		})
+	}
+
+	if c.Defaults != nil {
+		payload, err := json.Marshal(c.Defaults)
+		if err != nil {
+			return nil, fmt.Errorf("json encode defaults: %w", err)
+		}
+		newCommand("set_defaults", payload)
+	}
+
+	if c.compressionSetting != "" {
+		payload, err := json.Marshal(map[string]string{
+			"compression": c.compressionSetting,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("json encode compression: %w", err)
+		}
+		newCommand("set_compression", payload)
+	}
+
+	for _, sequence := range c.Sequences() {
+		payload, err := json.Marshal(&SetSequenceCommand{
+			Name:  sequence.Name,
+			Value: sequence.Value,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("json encode sequence '%s': %w", sequence.Name, err)
+		}
+		newCommand("set_sequence", payload)
+	}
+
+	indexes := c.Indexes() // building ones are persisted once ready
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		index := indexes[name]
+		payload, err := json.Marshal(&CreateIndexCommand{
+			Name:    name,
+			Type:    index.Type,
+			Options: index.Options,
+			Version: indexCommandVersion,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("json encode index '%s': %w", name, err)
+		}
+		newCommand("index", payload)
+	}
+
+	c.rowsMutex.Lock()
+	for _, row := range c.Rows {
+		newCommand("insert", row.Payload)
+		commands[len(commands)-1].RowId = row.Id
+		if revision := atomic.LoadInt64(&row.Revision); revision > 1 {
+			commands[len(commands)-1].Revision = revision
+		}
+	}
+	c.rowsMutex.Unlock()
+
+	return commands, nil
+}
+
+func (c *Collection) maybeAutoCompact() {
+
+	threshold := c.options.CompactAfter
+	if threshold <= 0 {
+		return
+	}
+
+	// Keeps trying while over the threshold, until a compaction succeeds
+	if atomic.AddInt64(&c.commandsSinceCompact, 1) < threshold {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&c.autoCompacting, 0, 1) {
+		return // already running
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&c.autoCompacting, 0)
+		stats, err := c.Compact()
+		if err != nil {
+			log.Println("ERROR: compact:", c.Filename, err.Error())
+			return
+		}
+		log.Println("COMPACT:", c.Filename, stats.Rows, "rows", stats.BytesBefore, "->", stats.BytesAfter, "bytes", stats.Duration)
+	}()
+}
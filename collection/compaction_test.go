@@ -0,0 +1,154 @@
+package collection
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestCompact(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.SetDefaults(map[string]any{"id": "uuid()"})
+		c.Index("my-index", &IndexMapOptions{
+			Field: "id",
+		})
+		row1, _ := c.Insert(map[string]interface{}{"id": "1", "name": "Pablo"})
+		c.Insert(map[string]interface{}{"id": "2", "name": "Sara"})
+		c.Insert(map[string]interface{}{"id": "3", "name": "Ana"})
+		c.Patch(row1, map[string]interface{}{"name": "Jaime"})
+		c.Remove(c.Rows[1])
+
+		// Run
+		stats, err := c.Compact()
+		c.Close()
+
+		// Check
+		AssertNil(err)
+		AssertEqual(stats.Rows, 2)
+		AssertEqual(stats.Indexes, 1)
+		content, _ := os.ReadFile(filename)
+		AssertEqual(bytes.Count(content, []byte("\n")), 4) // defaults + index + 2 inserts
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		user := map[string]interface{}{}
+		n := findByIndex(c.indexes["my-index"], `{"value":"1"}`, &user)
+		AssertEqual(n, 1)
+		AssertEqual(user["name"], "Jaime")
+		AssertEqual(len(c.Rows), 2)
+		AssertEqual(c.Defaults, map[string]any{"id": "uuid()"})
+
+		_, err = os.Stat(filename + compactingSuffix)
+		AssertTrue(os.IsNotExist(err))
+	})
+}
+
+func TestCompact_ConcurrentWrites(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		for i := 0; i < 1000; i++ {
+			c.Insert(map[string]interface{}{"n": i})
+		}
+
+		// Run
+		wg := &sync.WaitGroup{}
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 250; i++ {
+					c.Insert(map[string]interface{}{"hello": "world"})
+				}
+			}()
+		}
+		_, err := c.Compact()
+		wg.Wait()
+		c.Close()
+
+		// Check
+		AssertNil(err)
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 2000)
+	})
+}
+
+func TestCompact_Auto(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{CompactAfter: 10})
+		row, _ := c.Insert(map[string]interface{}{"counter": 0})
+
+		// Run
+		for i := 1; i <= 9; i++ {
+			c.Patch(row, map[string]interface{}{"counter": i})
+		}
+		waitCompaction(c)
+		c.Close()
+
+		// Check
+		AssertNotNil(c.LastCompaction)
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 1)
+		AssertEqual(string(c.Rows[0].Payload), `{"counter":9}`)
+	})
+}
+
+// waitCompaction waits for an automatic compaction to finish, if any
+func waitCompaction(c *Collection) *CompactionStats {
+	for i := 0; i < 100; i++ {
+		c.compactMutex.Lock()
+		stats := c.LastCompaction
+		c.compactMutex.Unlock()
+		if stats != nil {
+			return stats
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestCompact_AutoRetry(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup, the snapshot cannot be written
+		os.Mkdir(filename+compactingSuffix, 0777)
+		c, _ := OpenCollectionWithOptions(filename, &Options{CompactAfter: 3})
+		defer c.Close()
+		row, _ := c.Insert(map[string]interface{}{"counter": 0})
+		for i := 1; i <= 2; i++ {
+			c.Patch(row, map[string]interface{}{"counter": i})
+		}
+		for i := 0; i < 100 && atomic.LoadInt32(&c.autoCompacting) == 1; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		AssertNil(c.LastCompaction) // failed
+
+		// Run
+		os.Remove(filename + compactingSuffix)
+		c.Patch(row, map[string]interface{}{"counter": 3})
+
+		// Check
+		AssertNotNil(waitCompaction(c))
+	})
+}
+
+func TestIsAuxiliaryFile(t *testing.T) {
+	AssertTrue(IsAuxiliaryFile("data/users" + compactingSuffix))
+	AssertTrue(IsAuxiliaryFile("data/users" + manifestSuffix))
+	AssertTrue(IsAuxiliaryFile(segmentFilename("data/users", 1)))
+	AssertFalse(IsAuxiliaryFile("data/users"))
+	AssertFalse(IsAuxiliaryFile("data/users" + segmentInfix + "old"))
+}
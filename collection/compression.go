@@ -0,0 +1,358 @@
+package collection
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Compressed (or encrypted) journals are made of frames that can be mixed
+// with plain lines: a header line (see frameHeader), the stored bytes and a
+// newline. A frame always holds whole journal lines, so it is replayed as if
+// its content were written in plain.
+
+// Compression algorithms for new journal writes
+const (
+	CompressionNone    = "none"
+	CompressionDeflate = "deflate"
+)
+
+var frameMarker = []byte("#")
+
+// maxFrameSize bounds the memory used to decode a frame
+const maxFrameSize = 64 * 1024 * 1024
+
+// maxFrameData is the most plain bytes written in a frame, it leaves room for
+// the compression and encryption overhead within maxFrameSize
+var maxFrameData = maxFrameSize - 1024*1024
+
+// ValidateCompression returns an error if compression is not a known algorithm
+func ValidateCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionDeflate:
+		return nil
+	}
+	return fmt.Errorf("unexpected compression '%s' instead of [%s|%s]",
+		compression, CompressionNone, CompressionDeflate)
+}
+
+// Compression returns the algorithm used for new journal writes
+func (c *Collection) Compression() string {
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+	return c.compression()
+}
+
+// compression returns the collection setting or the default from options.
+// Caller must hold encoderMutex.
+func (c *Collection) compression() string {
+	compression := c.compressionSetting
+	if compression == "" {
+		compression = c.options.Compression
+	}
+	if compression == "" {
+		compression = CompressionNone
+	}
+	return compression
+}
+
+// journalWriter wraps the journal file according to the compression and the
+// encryption. Caller must hold encoderMutex.
+func (c *Collection) journalWriter(w io.Writer) io.Writer {
+	return newJournalWriter(w, c.compression(), c.sealer)
+}
+
+func newJournalWriter(w io.Writer, compression string, sealer *sealer) io.Writer {
+	compress := compression == CompressionDeflate
+	if !compress && sealer == nil {
+		return w
+	}
+	return &frameWriter{w: w, compress: compress, sealer: sealer}
+}
+
+// SetCompression changes the algorithm used for new journal writes. Existing
+// records are kept as they are until the next compaction.
+func (c *Collection) SetCompression(compression string) error {
+	return c.setCompression(compression, true)
+}
+
+func (c *Collection) setCompression(compression string, persist bool) error {
+
+	err := ValidateCompression(compression)
+	if err != nil {
+		return err
+	}
+
+	if persist {
+		c.commitMutex.RLock()
+		defer c.commitMutex.RUnlock()
+
+		payload, err := json.Marshal(map[string]string{
+			"compression": compression,
+		})
+		if err != nil {
+			return fmt.Errorf("json encode payload: %w", err)
+		}
+
+		command := &Command{
+			Name:      "set_compression",
+			Uuid:      uuid.New().String(),
+			Timestamp: time.Now().UnixNano(),
+			StartByte: 0,
+			Payload:   payload,
+		}
+
+		err = c.EncodeCommand(command)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+
+	if c.file != nil {
+		err = c.buffer.Flush()
+		if err != nil {
+			return fmt.Errorf("flush journal: %w", err)
+		}
+	}
+	c.compressionSetting = compression
+	if c.file != nil {
+		c.buffer.Reset(c.journalWriter(c.file))
+	}
+
+	return nil
+}
+
+// frameWriter turns every write into a frame. Incomplete lines are kept until
+// the rest of the line arrives, so frames always hold whole lines.
+type frameWriter struct {
+	w          io.Writer
+	compress   bool
+	sealer     *sealer // nil means no encryption
+	pending    []byte
+	compressor *flate.Writer
+	frame      bytes.Buffer
+}
+
+func (f *frameWriter) Write(p []byte) (int, error) {
+
+	f.pending = append(f.pending, p...)
+	i := bytes.LastIndexByte(f.pending, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	err := f.writeFrames(f.pending[:i+1])
+	f.pending = append(f.pending[:0], f.pending[i+1:]...)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// writeFrames splits whole lines in as many frames as needed to keep them
+// under maxFrameData
+func (f *frameWriter) writeFrames(data []byte) error {
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxFrameData {
+			n = 0
+			for n < len(data) {
+				end := n + bytes.IndexByte(data[n:], '\n') + 1
+				if end > maxFrameData {
+					break
+				}
+				n = end
+			}
+		}
+		if n == 0 {
+			return fmt.Errorf("frame: line of %d bytes exceeds the maximum frame size", bytes.IndexByte(data, '\n')+1)
+		}
+
+		err := f.writeFrame(data[:n])
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+
+	return nil
+}
+
+func (f *frameWriter) writeFrame(data []byte) error {
+
+	stored := data
+	codecs := []string{}
+
+	if f.compress {
+		var compressed bytes.Buffer
+		if f.compressor == nil {
+			f.compressor, _ = flate.NewWriter(&compressed, flate.DefaultCompression)
+		} else {
+			f.compressor.Reset(&compressed)
+		}
+		_, err := f.compressor.Write(stored)
+		if err == nil {
+			err = f.compressor.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("compress frame: %w", err)
+		}
+		stored = compressed.Bytes()
+		codecs = append(codecs, CompressionDeflate)
+	}
+
+	if f.sealer != nil {
+		sealed, err := f.sealer.seal(stored)
+		if err != nil {
+			return fmt.Errorf("encrypt frame: %w", err)
+		}
+		stored = sealed
+		codecs = append(codecs, encryptionAlgorithm)
+	}
+
+	if len(stored) > maxFrameSize {
+		return fmt.Errorf("frame: %d bytes exceeds the maximum frame size", len(stored))
+	}
+
+	f.frame.Reset()
+	f.frame.Write(frameMarker)
+	f.frame.WriteString(strings.Join(codecs, "+"))
+	if f.sealer != nil {
+		f.frame.WriteString(" " + f.sealer.id)
+	}
+	f.frame.WriteString(" " + strconv.Itoa(len(stored)))
+	f.frame.WriteString(" " + strconv.Itoa(len(data)))
+	f.frame.WriteString(" " + strconv.FormatUint(uint64(crc32.Checksum(stored, checksumTable)), 10))
+	f.frame.WriteByte('\n')
+	f.frame.Write(stored)
+	f.frame.WriteByte('\n')
+
+	// A single write, so an interrupted one is just a torn tail
+	_, err := f.w.Write(f.frame.Bytes())
+	return err
+}
+
+// frameHeader is the first line of a frame:
+//
+//	#<codecs> [<key id>] <stored bytes> <plain bytes> <crc32c of stored>
+//
+// where codecs is `deflate`, `aes-gcm` or `deflate+aes-gcm` and the key id is
+// only present for encrypted frames.
+type frameHeader struct {
+	Compressed bool
+	Encrypted  bool
+	KeyId      string
+	Stored     int
+	Plain      int
+	Checksum   uint32
+}
+
+// parseFrameHeader decodes the first line of a frame (newline included)
+func parseFrameHeader(line []byte) (*frameHeader, error) {
+
+	fields := strings.Fields(string(line[len(frameMarker):]))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("frame header: unexpected format")
+	}
+
+	header := &frameHeader{}
+	switch fields[0] {
+	case CompressionDeflate:
+		header.Compressed = true
+	case encryptionAlgorithm:
+		header.Encrypted = true
+	case CompressionDeflate + "+" + encryptionAlgorithm:
+		header.Compressed = true
+		header.Encrypted = true
+	default:
+		return nil, fmt.Errorf("frame header: unexpected codec '%s'", fields[0])
+	}
+	fields = fields[1:]
+
+	if header.Encrypted {
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("frame header: unexpected format")
+		}
+		header.KeyId = fields[0]
+		fields = fields[1:]
+	}
+
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("frame header: unexpected format")
+	}
+
+	var err error
+	header.Stored, err = strconv.Atoi(fields[0])
+	if err != nil || header.Stored < 0 || header.Stored > maxFrameSize {
+		return nil, fmt.Errorf("frame header: invalid stored size")
+	}
+	header.Plain, err = strconv.Atoi(fields[1])
+	if err != nil || header.Plain < 0 || header.Plain > maxFrameSize {
+		return nil, fmt.Errorf("frame header: invalid plain size")
+	}
+	checksum, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("frame header: invalid checksum")
+	}
+	header.Checksum = uint32(checksum)
+
+	return header, nil
+}
+
+// readFrameBody reads the stored bytes of a frame and its trailing newline.
+// On error the bytes read so far are returned.
+func readFrameBody(r io.Reader, header *frameHeader) ([]byte, error) {
+	body := make([]byte, header.Stored+1)
+	n, err := io.ReadFull(r, body)
+	return body[:n], err
+}
+
+// decodeFrame verifies, decrypts and decompresses the body of a frame. Errors
+// wrapping ErrEncryptionKey are not corruption but a configuration problem.
+func decodeFrame(header *frameHeader, body []byte, keyring *Keyring) ([]byte, error) {
+
+	if len(body) != header.Stored+1 || body[header.Stored] != '\n' {
+		return nil, fmt.Errorf("frame: incomplete")
+	}
+	data := body[:header.Stored]
+
+	sum := crc32.Checksum(data, checksumTable)
+	if sum != header.Checksum {
+		return nil, fmt.Errorf("frame: checksum mismatch: expected %d, obtained %d", header.Checksum, sum)
+	}
+
+	if header.Encrypted {
+		var err error
+		data, err = keyring.open(header.KeyId, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if header.Compressed {
+		var err error
+		data, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), int64(header.Plain)+1))
+		if err != nil {
+			return nil, fmt.Errorf("frame: decompress: %w", err)
+		}
+	}
+
+	if len(data) != header.Plain {
+		return nil, fmt.Errorf("frame: unexpected size %d instead of %d", len(data), header.Plain)
+	}
+
+	return data, nil
+}
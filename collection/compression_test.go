@@ -0,0 +1,153 @@
+package collection
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestCompression(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{Compression: CompressionDeflate})
+		for i := 0; i < 100; i++ {
+			c.Insert(map[string]interface{}{"n": i, "name": "Fulanez"})
+		}
+		c.Close()
+
+		// Check
+		content, _ := os.ReadFile(filename)
+		AssertTrue(bytes.HasPrefix(content, []byte("#deflate ")))
+		AssertFalse(bytes.Contains(content, []byte("Fulanez")))
+
+		c, err := OpenCollectionWithOptions(filename, &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 100)
+		AssertEqual(c.Compression(), CompressionNone)
+	})
+}
+
+func TestCompression_Convert(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		for i := 0; i < 100; i++ {
+			c.Insert(map[string]interface{}{"n": i, "name": "Fulanez"})
+		}
+		c.Commit(DurabilityFlush)
+		sizeBefore := c.JournalSize()
+
+		// Run
+		err := c.SetCompression(CompressionDeflate)
+		c.Insert(map[string]interface{}{"n": 100, "name": "Fulanez"})
+		c.Commit(DurabilityFlush)
+		content, _ := os.ReadFile(filename)
+		AssertTrue(bytes.Contains(content, []byte("\n#deflate "))) // mixed journal
+		stats, _ := c.Compact()
+		c.Close()
+
+		// Check
+		AssertNil(err)
+		AssertTrue(stats.BytesAfter < sizeBefore)
+		content, _ = os.ReadFile(filename)
+		AssertTrue(bytes.HasPrefix(content, []byte("#deflate ")))
+		AssertFalse(bytes.Contains(content, []byte("Fulanez")))
+
+		c, err = OpenCollection(filename)
+		AssertNil(err)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 101)
+		AssertEqual(c.Compression(), CompressionDeflate)
+	})
+}
+
+func TestCompression_TornFrame(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{Compression: CompressionDeflate, Durability: DurabilityFlush})
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		c.Insert(map[string]interface{}{"name": "Sara"})
+		c.Close()
+		content, _ := os.ReadFile(filename)
+		os.WriteFile(filename, content[:len(content)-5], 0666)
+
+		// Run
+		c, err := OpenCollection(filename)
+
+		// Check
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 1)
+		AssertTrue(c.Recovery.TruncatedBytes > 0)
+		c.Close()
+
+		c, err = OpenCollectionWithOptions(filename, &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 1)
+		c.Close()
+	})
+}
+
+func TestCompression_CorruptedFrame(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{Compression: CompressionDeflate, Durability: DurabilityFlush})
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		c.Insert(map[string]interface{}{"name": "Sara"})
+		c.Close()
+		content, _ := os.ReadFile(filename)
+		second := bytes.Index(content[1:], []byte("#deflate ")) + 1
+		content[second-2] ^= 0xff // last compressed byte of the first frame
+		os.WriteFile(filename, content, 0666)
+
+		// Run & check
+		_, err := OpenCollection(filename)
+		AssertNotNil(err)
+
+		c, err = OpenCollectionWithOptions(filename, &Options{Recovery: RecoverySkip})
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 1)
+		AssertEqual(len(c.Recovery.Corrupted), 1)
+		AssertEqual(c.Recovery.Corrupted[0].Offset, int64(0))
+		c.Close()
+	})
+}
+
+func TestCompression_LargeRecords(t *testing.T) {
+	Environment(func(filename string) {
+
+		defer func(previous int) { maxFrameData = previous }(maxFrameData)
+		maxFrameData = 64 * 1024
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{Compression: CompressionDeflate})
+		for i := 0; i < 10; i++ {
+			c.Insert(map[string]interface{}{"n": i, "data": strings.Repeat("x", 40*1024)})
+		}
+
+		// Run
+		_, err := c.Insert(map[string]interface{}{"data": strings.Repeat("x", 100*1024)})
+
+		// Check
+		AssertNotNil(err)
+		_, err = c.Insert(map[string]interface{}{"n": 10})
+		AssertNil(err)
+		c.Close()
+
+		content, _ := os.ReadFile(filename)
+		AssertTrue(bytes.Count(content, []byte("#deflate ")) > 1)
+
+		c, err = OpenCollectionWithOptions(filename, &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 11)
+		AssertTrue(len(c.Rows[9].Payload) > 40*1024)
+	})
+}
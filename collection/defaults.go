@@ -0,0 +1,356 @@
+package collection
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Defaults are values set on insert to the fields a document does not have.
+// A default is a constant or one of the generators:
+//   - uuid(), uuidv7() and ulid() unique identifiers
+//   - unixnano() and now() (RFC 3339 in UTC) insertion time
+//   - token(n) random string of n letters and digits (32 by default)
+//   - auto(), auto(name), auto(name, width) next value of a sequence (see
+//     Sequence), zero padded to width digits if given
+//   - onupdate(generator) also set by every patch that changes the document
+//
+// Fields can be nested with dots, like `meta.createdAt`.
+
+// ErrInvalidDefaults is returned when defaults cannot be compiled
+var ErrInvalidDefaults = errors.New("invalid defaults")
+
+// defaultValue is a compiled default
+type defaultValue struct {
+	Path     string
+	OnUpdate bool
+	Sequence string // sequence of auto(), empty for other defaults
+	Width    int    // zero padding of auto() values, zero means a number
+
+	generate func() (any, error) // nil for sequences
+}
+
+var defaultCall = regexp.MustCompile(`^([a-zA-Z0-9_]+)\((.*)\)$`)
+
+// compileDefaults validates and compiles defaults sorted by path. If lenient,
+// invalid generators are taken as constants (like older versions did).
+func compileDefaults(defaults map[string]any, lenient bool) ([]*defaultValue, error) {
+
+	paths := make([]string, 0, len(defaults))
+	for path := range defaults {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	result := make([]*defaultValue, 0, len(paths))
+	for _, path := range paths {
+		value, err := compileDefault(path, defaults[path])
+		if err != nil && lenient {
+			value, err = constantDefault(path, defaults[path]), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: '%s': %s", ErrInvalidDefaults, path, err)
+		}
+		result = append(result, value)
+	}
+
+	return result, nil
+}
+
+func constantDefault(path string, value any) *defaultValue {
+	return &defaultValue{
+		Path: path,
+		generate: func() (any, error) {
+			return cloneJSONValue(value), nil
+		},
+	}
+}
+
+func compileDefault(path string, value any) (*defaultValue, error) {
+
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			return nil, fmt.Errorf("invalid field path")
+		}
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return constantDefault(path, value), nil
+	}
+	call := defaultCall.FindStringSubmatch(strings.TrimSpace(s))
+	if call == nil {
+		return constantDefault(path, value), nil
+	}
+
+	name := call[1]
+	args := []string{}
+	if arg := strings.TrimSpace(call[2]); arg != "" {
+		for _, a := range strings.Split(arg, ",") {
+			args = append(args, strings.TrimSpace(a))
+		}
+	}
+
+	if name == "onupdate" {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("onupdate() expects a generator")
+		}
+		d, err := compileDefault(path, call[2])
+		if err != nil {
+			return nil, err
+		}
+		if d.Sequence != "" || d.OnUpdate {
+			return nil, fmt.Errorf("onupdate() cannot take %s", strings.TrimSpace(call[2]))
+		}
+		d.OnUpdate = true
+		return d, nil
+	}
+
+	d := &defaultValue{Path: path}
+	noArgs := func(f func() (any, error)) (*defaultValue, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("%s() does not take arguments", name)
+		}
+		d.generate = f
+		return d, nil
+	}
+
+	switch name {
+	case "uuid":
+		return noArgs(func() (any, error) {
+			return uuid.NewString(), nil
+		})
+	case "uuidv7":
+		return noArgs(func() (any, error) {
+			id, err := uuid.NewV7()
+			if err != nil {
+				return nil, err
+			}
+			return id.String(), nil
+		})
+	case "ulid":
+		return noArgs(func() (any, error) {
+			return newULID()
+		})
+	case "unixnano":
+		return noArgs(func() (any, error) {
+			return time.Now().UnixNano(), nil
+		})
+	case "now":
+		return noArgs(func() (any, error) {
+			return time.Now().UTC().Format(time.RFC3339Nano), nil
+		})
+	case "token":
+		length := 32
+		if len(args) > 1 {
+			return nil, fmt.Errorf("token() expects a length")
+		}
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 || n > 1024 {
+				return nil, fmt.Errorf("token() length must be between 1 and 1024")
+			}
+			length = n
+		}
+		d.generate = func() (any, error) {
+			return newToken(length)
+		}
+		return d, nil
+	case "auto":
+		if len(args) > 2 {
+			return nil, fmt.Errorf("auto() expects a sequence and a width")
+		}
+		d.Sequence = defaultSequence
+		if len(args) > 0 && args[0] != "" {
+			d.Sequence = args[0]
+		}
+		if len(args) == 2 {
+			width, err := strconv.Atoi(args[1])
+			if err != nil || width < 1 || width > 20 {
+				return nil, fmt.Errorf("auto() width must be between 1 and 20")
+			}
+			d.Width = width
+		}
+		return d, nil
+	}
+
+	return nil, fmt.Errorf("unknown generator %s()", name)
+}
+
+// sequenceValue formats a value of the sequence
+func (d *defaultValue) sequenceValue(value int64) any {
+	if d.Width > 0 {
+		return fmt.Sprintf("%0*d", d.Width, value)
+	}
+	return value
+}
+
+// parseSequenceValue is the inverse of sequenceValue
+func (d *defaultValue) parseSequenceValue(value any) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case float64:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil && d.Width > 0
+	}
+	return 0, false
+}
+
+// getPath returns the value of a dotted path
+func getPath(document map[string]any, path string) (any, bool) {
+	parent, key, err := lookupPath(document, path, false)
+	if err != nil || parent == nil {
+		return nil, false
+	}
+	value, exists := parent[key]
+	return value, exists
+}
+
+// setPath sets the value of a dotted path, creating the missing objects
+func setPath(document map[string]any, path string, value any) error {
+	parent, key, err := lookupPath(document, path, true)
+	if err != nil {
+		return err
+	}
+	parent[key] = value
+	return nil
+}
+
+// applyDefaults sets the defaults missing in item, except sequences, and
+// returns the sequences to be taken
+func (c *Collection) applyDefaults(item map[string]any) ([]*defaultValue, error) {
+
+	generated := []*defaultValue{}
+	for _, d := range c.defaultValues {
+		if value, exists := getPath(item, d.Path); exists && value != nil {
+			continue
+		}
+		if d.Sequence != "" {
+			generated = append(generated, d)
+			continue
+		}
+		value, err := d.generate()
+		if err != nil {
+			return nil, fmt.Errorf("default '%s': %w", d.Path, err)
+		}
+		err = setPath(item, d.Path, value)
+		if err != nil {
+			return nil, fmt.Errorf("default '%s': %w", d.Path, err)
+		}
+	}
+
+	return generated, nil
+}
+
+// withOnUpdate applies the onupdate() defaults after a patch function if it
+// changes the document
+func (c *Collection) withOnUpdate(apply func(original interface{}) (interface{}, bool, error)) func(original interface{}) (interface{}, bool, error) {
+	return func(original interface{}) (interface{}, bool, error) {
+		modified, changed, err := apply(original)
+		if err != nil || !changed {
+			return modified, changed, err
+		}
+		return modified, true, c.applyOnUpdate(original, modified)
+	}
+}
+
+// applyOnUpdate sets the onupdate() defaults of a patched document, except
+// the fields set by the patch itself
+func (c *Collection) applyOnUpdate(original, modified interface{}) error {
+
+	originalMap, _ := original.(map[string]interface{})
+	modifiedMap, ok := modified.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	for _, d := range c.defaultValues {
+		if !d.OnUpdate {
+			continue
+		}
+		before, _ := getPath(originalMap, d.Path)
+		after, _ := getPath(modifiedMap, d.Path)
+		if !reflect.DeepEqual(before, after) {
+			continue // set by the patch
+		}
+		value, err := d.generate()
+		if err != nil {
+			return fmt.Errorf("default '%s': %w", d.Path, err)
+		}
+		err = setPath(modifiedMap, d.Path, value)
+		if err != nil {
+			return fmt.Errorf("default '%s': %w", d.Path, err)
+		}
+	}
+
+	return nil
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: 48 bits of unix milliseconds and 80 random bits in
+// Crockford base32
+func newULID() (string, error) {
+
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	_, err := rand.Read(b[6:])
+	if err != nil {
+		return "", err
+	}
+
+	out := make([]byte, 26)
+	for i := range out {
+		v := 0
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2 // 130 bits, the first 2 are padding
+			v <<= 1
+			if bit >= 0 && b[bit/8]&(0x80>>(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockfordAlphabet[v]
+	}
+
+	return string(out), nil
+}
+
+const tokenAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// newToken returns a random string of letters and digits
+func newToken(length int) (string, error) {
+
+	out := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(out) < length {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= 256/len(tokenAlphabet)*len(tokenAlphabet) {
+				continue // uniform distribution
+			}
+			out = append(out, tokenAlphabet[int(b)%len(tokenAlphabet)])
+			if len(out) == length {
+				break
+			}
+		}
+	}
+
+	return string(out), nil
+}
@@ -0,0 +1,136 @@
+package collection
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestDefaults_Generators(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		err := c.SetDefaults(map[string]any{
+			"uuid":           "uuidv7()",
+			"ulid":           "ulid()",
+			"token":          "token(16)",
+			"number":         "auto(orders, 6)",
+			"meta.createdAt": "now()",
+			"meta.source":    "api",
+		})
+		AssertNil(err)
+
+		// Run
+		row, err := c.Insert(map[string]any{"meta": map[string]any{"source": "import"}})
+		AssertNil(err)
+
+		// Check
+		document := decodePayload(row)
+		AssertTrue(regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`).MatchString(document["uuid"].(string)))
+		AssertTrue(regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`).MatchString(document["ulid"].(string)))
+		AssertTrue(regexp.MustCompile(`^[0-9A-Za-z]{16}$`).MatchString(document["token"].(string)))
+		AssertEqual(document["number"], "000001")
+
+		meta := document["meta"].(map[string]any)
+		AssertEqual(meta["source"], "import") // not overwritten
+		_, err = time.Parse(time.RFC3339Nano, meta["createdAt"].(string))
+		AssertNil(err)
+	})
+}
+
+func TestDefaults_Invalid(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+
+		invalid := []map[string]any{
+			{"id": "foo()"},
+			{"id": "uuid(4)"},
+			{"token": "token(0)"},
+			{"id": "auto(a, b, c)"},
+			{"id": "auto(orders, wide)"},
+			{"updatedAt": "onupdate(auto())"},
+			{"meta..createdAt": "now()"},
+		}
+		for _, defaults := range invalid {
+			err := c.SetDefaults(defaults)
+			AssertTrue(errors.Is(err, ErrInvalidDefaults))
+		}
+		AssertNil(c.Defaults)
+	})
+}
+
+func TestDefaults_LegacyLiterals(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup, stored as a literal by older versions
+		os.WriteFile(filename, []byte(`{"name":"set_defaults","uuid":"1","timestamp":1,"start_byte":0,"payload":{"kind":"foo()"}}
+`), 0666)
+
+		// Run
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]any{})
+
+		// Check
+		AssertEqualJson(decodePayload(row), map[string]any{"kind": "foo()"})
+	})
+}
+
+func TestDefaults_OnUpdate(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.SetDefaults(map[string]any{"updatedAt": "onupdate(unixnano())"})
+		row, _ := c.Insert(map[string]any{"name": "Ana"})
+		inserted := decodePayload(row)["updatedAt"]
+		AssertNotNil(inserted)
+
+		// Run
+		c.Patch(row, map[string]any{"name": "Anna"})
+		patched := decodePayload(row)["updatedAt"]
+
+		c.Patch(row, map[string]any{"name": "Anna"}) // unchanged
+		AssertEqual(decodePayload(row)["updatedAt"], patched)
+
+		c.Patch(row, map[string]any{"name": "Hanna", "updatedAt": 1})
+		AssertEqual(decodePayload(row)["updatedAt"], float64(1)) // set by the patch
+		c.Patch(row, map[string]any{"name": "Anne"})
+		last := decodePayload(row)["updatedAt"]
+		c.Close()
+
+		// Check
+		AssertTrue(patched.(float64) > inserted.(float64))
+		AssertTrue(last.(float64) > 1)
+
+		c, _ = OpenCollection(filename) // replayed, not generated again
+		defer c.Close()
+		AssertEqual(decodePayload(c.Rows[0])["updatedAt"], last)
+	})
+}
+
+func TestDefaults_PaddedSequenceRestart(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup, written before sequences were persisted
+		os.WriteFile(filename, []byte(`{"name":"set_defaults","uuid":"1","timestamp":1,"start_byte":0,"payload":{"number":"auto(invoices, 4)"}}
+{"name":"insert","uuid":"2","timestamp":2,"start_byte":0,"payload":{"number":"0007"}}
+`), 0666)
+
+		// Run
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]any{})
+
+		// Check
+		AssertEqualJson(decodePayload(row), map[string]any{"number": "0008"})
+	})
+}
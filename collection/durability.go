@@ -0,0 +1,118 @@
+package collection
+
+import (
+	"fmt"
+)
+
+// Durability levels, from the fastest to the safest
+const (
+	DurabilityBuffered = "buffered" // journal is flushed in background every few seconds
+	DurabilityFlush    = "flush"    // journal is flushed to the OS on every write
+	DurabilityFsync    = "fsync"    // journal is flushed and synced to disk on every write
+	DurabilityGroup    = "group"    // like fsync, but concurrent writers share the same sync
+)
+
+// ValidateDurability returns an error if durability is not a known level
+func ValidateDurability(durability string) error {
+	switch durability {
+	case "", DurabilityBuffered, DurabilityFlush, DurabilityFsync, DurabilityGroup:
+		return nil
+	}
+	return fmt.Errorf("unexpected durability '%s' instead of [%s|%s|%s|%s]",
+		durability, DurabilityBuffered, DurabilityFlush, DurabilityFsync, DurabilityGroup)
+}
+
+// Durability returns the level applied to every write of this collection
+func (c *Collection) Durability() string {
+	if c.options.Durability == "" {
+		return DurabilityBuffered
+	}
+	return c.options.Durability
+}
+
+// Commit blocks until all commands written so far satisfy the durability level.
+// It is called after every write with the collection level, and can be called
+// again with a stronger level to fulfil the requirements of a single request.
+func (c *Collection) Commit(durability string) error {
+
+	switch durability {
+	case "", DurabilityBuffered:
+		return nil
+	case DurabilityFlush:
+		c.encoderMutex.Lock()
+		defer c.encoderMutex.Unlock()
+		if c.file == nil {
+			return fmt.Errorf("collection is closed")
+		}
+		return c.buffer.Flush()
+	case DurabilityFsync:
+		c.encoderMutex.Lock()
+		defer c.encoderMutex.Unlock()
+		_, err := c.sync()
+		return err
+	case DurabilityGroup:
+		return c.groupCommit()
+	}
+
+	return ValidateDurability(durability)
+}
+
+// sync flushes the buffer and syncs the journal file. Caller must hold
+// encoderMutex. It returns the sequence of the last command made durable.
+func (c *Collection) sync() (int64, error) {
+
+	if c.file == nil {
+		return 0, fmt.Errorf("collection is closed")
+	}
+
+	err := c.buffer.Flush()
+	if err != nil {
+		return 0, fmt.Errorf("flush journal: %w", err)
+	}
+
+	err = c.file.Sync()
+	if err != nil {
+		return 0, fmt.Errorf("sync journal: %w", err)
+	}
+
+	return c.writtenSeq, nil
+}
+
+// groupCommit waits until a sync covers the last command written. The first
+// waiter becomes the leader and syncs on behalf of everybody queued behind it.
+func (c *Collection) groupCommit() error {
+
+	c.encoderMutex.Lock()
+	seq := c.writtenSeq
+	c.encoderMutex.Unlock()
+
+	c.syncMutex.Lock()
+	defer c.syncMutex.Unlock()
+
+	for c.syncedSeq < seq {
+		if c.syncing {
+			c.syncCond.Wait()
+			continue
+		}
+
+		c.syncing = true
+		c.syncMutex.Unlock()
+
+		c.encoderMutex.Lock()
+		synced, err := c.sync()
+		c.encoderMutex.Unlock()
+
+		c.syncMutex.Lock()
+		c.syncing = false
+		if err == nil && synced > c.syncedSeq {
+			c.syncedSeq = synced
+		}
+		c.syncCond.Broadcast()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
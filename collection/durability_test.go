@@ -0,0 +1,90 @@
+package collection
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestDurability(t *testing.T) {
+
+	expectedLines := map[string]int{
+		DurabilityBuffered: 0,
+		DurabilityFlush:    1,
+		DurabilityFsync:    1,
+		DurabilityGroup:    1,
+	}
+
+	for durability, expected := range expectedLines {
+		Environment(func(filename string) {
+
+			// Setup
+			c, err := OpenCollectionWithOptions(filename, &Options{Durability: durability})
+			AssertNil(err)
+			defer c.Close()
+
+			// Run
+			c.Insert(map[string]interface{}{"hello": "world"})
+
+			// Check
+			content, _ := os.ReadFile(filename)
+			AssertEqual(bytes.Count(content, []byte("\n")), expected)
+		})
+	}
+}
+
+func TestDurability_CommitPerRequest(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.Insert(map[string]interface{}{"hello": "world"})
+
+		// Run
+		err := c.Commit(DurabilityFsync)
+
+		// Check
+		AssertNil(err)
+		content, _ := os.ReadFile(filename)
+		AssertEqual(bytes.Count(content, []byte("\n")), 1)
+	})
+}
+
+func TestDurability_GroupConcurrency(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{Durability: DurabilityGroup})
+		defer c.Close()
+
+		// Run
+		workers, n := 16, 50
+		wg := &sync.WaitGroup{}
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					_, err := c.Insert(map[string]interface{}{"hello": "world"})
+					AssertNil(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Check
+		content, _ := os.ReadFile(filename)
+		AssertEqual(bytes.Count(content, []byte("\n")), workers*n)
+	})
+}
+
+func TestDurability_Invalid(t *testing.T) {
+	Environment(func(filename string) {
+		_, err := OpenCollectionWithOptions(filename, &Options{Durability: "forever"})
+		AssertNotNil(err)
+	})
+}
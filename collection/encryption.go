@@ -0,0 +1,183 @@
+package collection
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Encrypted journals are made of frames (see compression.go) whose content is
+// sealed with AES-GCM. Every frame names the key it was encrypted with, so a
+// journal can be read while it holds records from several keys.
+
+const encryptionAlgorithm = "aes-gcm"
+
+// ErrEncryptionKey means a journal cannot be read with the configured keys
+var ErrEncryptionKey = errors.New("encryption key")
+
+// Keyring holds the key used to encrypt new journal records and the previous
+// keys that can still be found in existing ones. Keys are rotated by moving
+// the current key to Previous, setting a new one and compacting.
+type Keyring struct {
+	Current  []byte
+	Previous [][]byte
+}
+
+// ParseKey decodes a base64 AES key of 16, 24 or 32 bytes
+func ParseKey(encoded string) ([]byte, error) {
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unexpected key length %d instead of [16|24|32] bytes", len(key))
+}
+
+// NewKeyring builds a keyring from a base64 key (or a file containing it) and
+// a comma separated list of previous base64 keys. Nil means no encryption.
+func NewKeyring(key, keyFile, previousKeys string) (*Keyring, error) {
+
+	if keyFile != "" {
+		if key != "" {
+			return nil, fmt.Errorf("encryption key: set either a key or a key file")
+		}
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key file: %w", err)
+		}
+		key = string(data)
+	}
+
+	if key == "" && previousKeys == "" {
+		return nil, nil
+	}
+
+	keyring := &Keyring{}
+
+	if key != "" {
+		current, err := ParseKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key: %w", err)
+		}
+		keyring.Current = current
+	}
+
+	for i, encoded := range strings.Split(previousKeys, ",") {
+		if strings.TrimSpace(encoded) == "" {
+			continue
+		}
+		previous, err := ParseKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("previous encryption key %d: %w", i, err)
+		}
+		keyring.Previous = append(keyring.Previous, previous)
+	}
+
+	return keyring, nil
+}
+
+// KeyId identifies a key without revealing it
+func KeyId(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptionKeyId returns the id of the key that encrypts new journal
+// records, empty if encryption is disabled
+func (c *Collection) EncryptionKeyId() string {
+	if c.sealer == nil {
+		return ""
+	}
+	return c.sealer.id
+}
+
+// find returns the key with the given id
+func (k *Keyring) find(id string) []byte {
+	if k == nil {
+		return nil
+	}
+	if k.Current != nil && KeyId(k.Current) == id {
+		return k.Current
+	}
+	for _, key := range k.Previous {
+		if KeyId(key) == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// open decrypts the content of a frame. Errors are always ErrEncryptionKey
+// since the frame checksum has been verified before.
+func (k *Keyring) open(id string, sealed []byte) ([]byte, error) {
+
+	if k == nil {
+		return nil, fmt.Errorf("%w: journal is encrypted with key '%s' but no key is configured", ErrEncryptionKey, id)
+	}
+
+	key := k.find(id)
+	if key == nil {
+		return nil, fmt.Errorf("%w: journal is encrypted with key '%s' which is not configured", ErrEncryptionKey, id)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrEncryptionKey, err.Error())
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: frame too short", ErrEncryptionKey)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	data, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decrypt with key '%s': %s", ErrEncryptionKey, id, err.Error())
+	}
+
+	return data, nil
+}
+
+// sealer encrypts frames with a single key
+type sealer struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func newSealer(key []byte) (*sealer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{id: KeyId(key), aead: aead}, nil
+}
+
+func (s *sealer) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	return s.aead.Seal(nonce, nonce, data, nil), nil
+}
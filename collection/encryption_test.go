@@ -0,0 +1,133 @@
+package collection
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func newTestKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+func TestParseKey(t *testing.T) {
+
+	key := newTestKey()
+	parsed, err := ParseKey(base64.StdEncoding.EncodeToString(key) + "\n")
+	AssertNil(err)
+	AssertEqual(parsed, key)
+
+	_, err = ParseKey(base64.StdEncoding.EncodeToString(key[:10]))
+	AssertNotNil(err)
+
+	_, err = ParseKey("not base64!")
+	AssertNotNil(err)
+}
+
+func TestEncryption(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		key := newTestKey()
+		c, _ := OpenCollectionWithOptions(filename, &Options{Keyring: &Keyring{Current: key}})
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		c.Insert(map[string]interface{}{"name": "Sara"})
+		c.Close()
+
+		// Check
+		content, _ := os.ReadFile(filename)
+		AssertTrue(bytes.HasPrefix(content, []byte("#aes-gcm "+KeyId(key)+" ")))
+		AssertFalse(bytes.Contains(content, []byte("Pablo")))
+
+		c, err := OpenCollectionWithOptions(filename, &Options{Keyring: &Keyring{Current: key}, Recovery: RecoveryStrict})
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 2)
+		c.Close()
+
+		_, err = OpenCollectionWithOptions(filename, &Options{Recovery: RecoverySkip})
+		AssertTrue(errors.Is(err, ErrEncryptionKey))
+
+		_, err = OpenCollectionWithOptions(filename, &Options{Keyring: &Keyring{Current: newTestKey()}, Recovery: RecoverySkip})
+		AssertTrue(errors.Is(err, ErrEncryptionKey))
+
+		content, _ = os.ReadFile(filename)
+		AssertTrue(bytes.HasPrefix(content, []byte("#aes-gcm "))) // untouched by failed opens
+	})
+}
+
+func TestEncryption_Compressed(t *testing.T) {
+	Environment(func(filename string) {
+
+		key := newTestKey()
+		options := &Options{Keyring: &Keyring{Current: key}, Compression: CompressionDeflate}
+		c, _ := OpenCollectionWithOptions(filename, options)
+		for i := 0; i < 100; i++ {
+			c.Insert(map[string]interface{}{"n": i})
+		}
+		c.Close()
+
+		content, _ := os.ReadFile(filename)
+		AssertTrue(bytes.HasPrefix(content, []byte("#deflate+aes-gcm ")))
+
+		c, err := OpenCollectionWithOptions(filename, options)
+		AssertNil(err)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 100)
+	})
+}
+
+func TestEncryption_Rotation(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		oldKey := newTestKey()
+		newKey := newTestKey()
+		c, _ := OpenCollection(filename)
+		c.Insert(map[string]interface{}{"name": "Plain"})
+		c.Close()
+		c, _ = OpenCollectionWithOptions(filename, &Options{Keyring: &Keyring{Current: oldKey}})
+		c.Insert(map[string]interface{}{"name": "Old"})
+		c.Close()
+
+		// Run
+		c, err := OpenCollectionWithOptions(filename, &Options{Keyring: &Keyring{Current: newKey, Previous: [][]byte{oldKey}}})
+		AssertNil(err)
+		_, err = c.Compact()
+		c.Close()
+
+		// Check
+		AssertNil(err)
+		content, _ := os.ReadFile(filename)
+		AssertFalse(bytes.Contains(content, []byte(KeyId(oldKey))))
+		AssertFalse(bytes.Contains(content, []byte("Plain")))
+
+		c, err = OpenCollectionWithOptions(filename, &Options{Keyring: &Keyring{Current: newKey}})
+		AssertNil(err)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 2)
+	})
+}
+
+func TestEncryption_PointInTime(t *testing.T) {
+	Environment(func(filename string) {
+
+		options := &Options{Keyring: &Keyring{Current: newTestKey()}}
+		c, _ := OpenCollectionWithOptions(filename, options)
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		c.Close()
+
+		_, err := OpenCollectionAt(filename, &PointInTime{Timestamp: 1})
+		AssertTrue(errors.Is(err, ErrEncryptionKey))
+
+		historical, err := OpenCollectionAtWithOptions(filename, &PointInTime{Timestamp: 1 << 62}, options)
+		AssertNil(err)
+		AssertEqual(len(historical.Rows), 1)
+	})
+}
@@ -1,12 +1,13 @@
 package collection
 
 import (
-	"encoding/json"
 	"fmt"
-	"reflect"
+	"math"
 	"strings"
 
 	"github.com/google/btree"
+
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 type IndexBtree struct {
@@ -16,13 +17,9 @@ type IndexBtree struct {
 
 func (b *IndexBtree) RemoveRow(r *Row) error {
 
-	// TODO: duplicated code:
-	values := []interface{}{}
-	data := map[string]interface{}{}
-	json.Unmarshal(r.Payload, &data)
-
-	for _, field := range b.Options.Fields {
-		values = append(values, data[field])
+	values, indexed, err := b.rowValues(r)
+	if err != nil || !indexed {
+		return err
 	}
 
 	b.Btree.Delete(&RowOrdered{
@@ -42,6 +39,20 @@ type IndexBtreeTraverse struct {
 type RowOrdered struct {
 	*Row
 	Values []interface{}
+
+	last bool // pivot placed after the rows with the same values
+}
+
+// position orders the rows with the same values in a non unique index, a
+// pivot without row goes first
+func (r *RowOrdered) position() int64 {
+	if r.last {
+		return math.MaxInt64
+	}
+	if r.Row == nil {
+		return math.MinInt64
+	}
+	return r.Row.Id
 }
 
 type IndexBTreeOptions struct {
@@ -55,45 +66,20 @@ func NewIndexBTree(options *IndexBTreeOptions) *IndexBtree {
 	index := btree.NewG(32, func(a, b *RowOrdered) bool {
 
 		for i, valA := range a.Values {
-			valB := b.Values[i]
-			if reflect.DeepEqual(valA, valB) {
+			cmp := compareIndexValues(valA, b.Values[i])
+			if cmp == 0 {
 				continue
 			}
-
-			field := options.Fields[i]
-			reverse := strings.HasPrefix(field, "-")
-			field = strings.TrimPrefix(field, "-")
-
-			switch valA := valA.(type) {
-			case string:
-				valB, ok := valB.(string)
-				if !ok {
-					panic("Type B should be string for field " + field)
-				}
-				if reverse {
-					return !(valA < valB)
-				} else {
-					return valA < valB
-				}
-
-			case float64:
-				valB, ok := valB.(float64)
-				if !ok {
-					panic("Type B should be float64 for field " + field)
-				}
-				if reverse {
-					return !(valA < valB)
-				} else {
-					return valA < valB
-				}
-
-				// todo: case bool
-			default:
-				panic("Type A not supported, field " + field)
+			if strings.HasPrefix(options.Fields[i], "-") {
+				return cmp > 0
 			}
+			return cmp < 0
 		}
 
-		return false
+		if options.Unique {
+			return false
+		}
+		return a.position() < b.position() // duplicated values by row id
 	})
 
 	return &IndexBtree{
@@ -102,25 +88,184 @@ func NewIndexBTree(options *IndexBTreeOptions) *IndexBtree {
 	}
 }
 
-func (b *IndexBtree) AddRow(r *Row) error {
-	var values []interface{}
+// Index values of different types are ordered by type:
+// null < bool < number < string < array < object
+const (
+	rankNull = iota
+	rankBool
+	rankNumber
+	rankString
+	rankArray
+	rankObject
+	rankUnsupported
+)
+
+func indexValueRank(value interface{}) int {
+
+	switch value.(type) {
+	case nil:
+		return rankNull
+	case bool:
+		return rankBool
+	case string:
+		return rankString
+	case []interface{}:
+		return rankArray
+	case map[string]interface{}:
+		return rankObject
+	}
+
+	if _, ok := utils.ToNumber(value); ok {
+		return rankNumber
+	}
+
+	return rankUnsupported
+}
+
+// compareIndexValues is a total order of JSON values: by type, then by value.
+// Arrays are compared item by item, objects key by key (sorted).
+func compareIndexValues(a, b interface{}) int {
+
+	rankA, rankB := indexValueRank(a), indexValueRank(b)
+	if rankA != rankB {
+		if rankA < rankB {
+			return -1
+		}
+		return 1
+	}
+
+	switch rankA {
+	case rankBool:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+
+	case rankNumber:
+		x, _ := utils.ToNumber(a)
+		y, _ := utils.ToNumber(b)
+		cmp, err := utils.CompareNumbers(x, y)
+		if err != nil {
+			return strings.Compare(string(x), string(y)) // not reachable with validated values
+		}
+		return cmp
+
+	case rankString:
+		return strings.Compare(a.(string), b.(string))
+
+	case rankArray:
+		x, y := a.([]interface{}), b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if cmp := compareIndexValues(x[i], y[i]); cmp != 0 {
+				return cmp
+			}
+		}
+		return compareLengths(len(x), len(y))
+
+	case rankObject:
+		x, y := a.(map[string]interface{}), b.(map[string]interface{})
+		keysX, keysY := sortedKeys(x), sortedKeys(y)
+		for i := 0; i < len(keysX) && i < len(keysY); i++ {
+			if cmp := strings.Compare(keysX[i], keysY[i]); cmp != 0 {
+				return cmp
+			}
+			if cmp := compareIndexValues(x[keysX[i]], y[keysY[i]]); cmp != 0 {
+				return cmp
+			}
+		}
+		return compareLengths(len(keysX), len(keysY))
+
+	case rankUnsupported:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)) // not reachable with validated values
+	}
+
+	return 0 // null
+}
+
+func compareLengths(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// validateIndexValue checks that a value can be ordered by the index
+func validateIndexValue(value interface{}) error {
+
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := validateIndexValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := validateIndexValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if indexValueRank(value) == rankUnsupported {
+		return fmt.Errorf("type %T is not supported", value)
+	}
+	if number, ok := utils.ToNumber(value); ok {
+		if _, err := utils.CompareNumbers(number, number); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rowValues returns the key of a row in the index, or false if it is not
+// indexed (sparse)
+func (b *IndexBtree) rowValues(r *Row) ([]interface{}, bool, error) {
+
 	data := map[string]interface{}{}
-	json.Unmarshal(r.Payload, &data)
+	err := utils.DecodeJSON(r.Payload, &data)
+	if err != nil {
+		return nil, false, fmt.Errorf("unmarshal: %w", err)
+	}
 
+	values := make([]interface{}, 0, len(b.Options.Fields))
 	for _, field := range b.Options.Fields {
 		field = strings.TrimPrefix(field, "-")
 		value, exists := data[field]
-		if exists {
-			values = append(values, value)
-			continue
+		if !exists {
+			if b.Options.Sparse {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("field '%s' not defined", field)
 		}
-		if b.Options.Sparse {
-			return nil
+		err := validateIndexValue(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("field '%s': %w", field, err)
 		}
-		return fmt.Errorf("field '%s' not defined", field)
+		values = append(values, value)
+	}
+
+	return values, true, nil
+}
+
+func (b *IndexBtree) AddRow(r *Row) error {
+
+	values, indexed, err := b.rowValues(r)
+	if err != nil || !indexed {
+		return err
 	}
 
-	if b.Btree.Has(&RowOrdered{Values: values}) {
+	if b.Options.Unique && b.Btree.Has(&RowOrdered{Values: values}) {
 		errKey := ""
 		for i, field := range b.Options.Fields {
 			pair := fmt.Sprint(field, ":", values[i])
@@ -130,7 +275,7 @@ func (b *IndexBtree) AddRow(r *Row) error {
 				errKey = pair
 			}
 		}
-		return fmt.Errorf("key (%s) already exists", errKey)
+		return newDuplicateKeyError("key (%s) already exists", errKey)
 	}
 
 	b.Btree.ReplaceOrInsert(&RowOrdered{
@@ -144,7 +289,7 @@ func (b *IndexBtree) AddRow(r *Row) error {
 func (b *IndexBtree) Traverse(optionsData []byte, f func(*Row) bool) {
 
 	options := &IndexBtreeTraverse{}
-	json.Unmarshal(optionsData, options) // todo: handle error
+	utils.DecodeJSON(optionsData, options) // todo: handle error
 
 	iterator := func(r *RowOrdered) bool {
 		return f(r.Row)
@@ -153,7 +298,9 @@ func (b *IndexBtree) Traverse(optionsData []byte, f func(*Row) bool) {
 	hasFrom := len(options.From) > 0
 	hasTo := len(options.To) > 0
 
-	pivotFrom := &RowOrdered{}
+	// Pivots go before the rows with the same values when ascending and after
+	// them when descending, so from and to mean the same in both directions
+	pivotFrom := &RowOrdered{last: options.Reverse}
 	if hasFrom {
 		for _, field := range b.Options.Fields {
 			field = strings.TrimPrefix(field, "-")
@@ -161,7 +308,7 @@ func (b *IndexBtree) Traverse(optionsData []byte, f func(*Row) bool) {
 		}
 	}
 
-	pivotTo := &RowOrdered{}
+	pivotTo := &RowOrdered{last: options.Reverse}
 	if hasTo {
 		for _, field := range b.Options.Fields {
 			field = strings.TrimPrefix(field, "-")
@@ -169,6 +169,81 @@ func TestIndexBtree_AddRow_Conflict(t *testing.T) {
 	biff.AssertEqual(errConflict.Error(), "key (product_code:1,product_category:cat1) already exists")
 }
 
+func TestIndexBtree_MixedTypes(t *testing.T) {
+
+	index := NewIndexBTree(&IndexBTreeOptions{
+		Fields: []string{"v"},
+		Unique: true,
+	})
+
+	documents := []string{
+		`{"v":{"b":1}}`,
+		`{"v":"b"}`,
+		`{"v":[1,2]}`,
+		`{"v":true}`,
+		`{"v":2}`,
+		`{"v":null}`,
+		`{"v":{"a":2}}`,
+		`{"v":[1]}`,
+		`{"v":"a"}`,
+		`{"v":false}`,
+		`{"v":1.5}`,
+		`{"v":{"a":1,"b":1}}`,
+	}
+	for _, document := range documents {
+		err := index.AddRow(&Row{Payload: json.RawMessage(document)})
+		biff.AssertNil(err)
+	}
+
+	errConflict := index.AddRow(&Row{Payload: json.RawMessage(`{"v":[1,2.0]}`)})
+	biff.AssertEqual(errConflict.Error(), "key (v:[1 2.0]) already exists")
+
+	expected := []string{
+		`{"v":null}`,
+		`{"v":false}`,
+		`{"v":true}`,
+		`{"v":1.5}`,
+		`{"v":2}`,
+		`{"v":"a"}`,
+		`{"v":"b"}`,
+		`{"v":[1]}`,
+		`{"v":[1,2]}`,
+		`{"v":{"a":1,"b":1}}`,
+		`{"v":{"a":2}}`,
+		`{"v":{"b":1}}`,
+	}
+	obtained := []string{}
+	index.Traverse([]byte(`{}`), func(row *Row) bool {
+		obtained = append(obtained, string(row.Payload))
+		return true
+	})
+	biff.AssertEqual(obtained, expected)
+
+	obtained = []string{}
+	index.Traverse([]byte(`{"from":{"v":"a"},"to":{"v":[]}}`), func(row *Row) bool {
+		obtained = append(obtained, string(row.Payload))
+		return true
+	})
+	biff.AssertEqual(obtained, []string{`{"v":"a"}`, `{"v":"b"}`})
+}
+
+func TestIndexBtree_RemoveRow_Reverse(t *testing.T) {
+
+	index := NewIndexBTree(&IndexBTreeOptions{
+		Fields: []string{"-year"},
+	})
+
+	for _, document := range []string{`{"year":1985}`, `{"year":1986}`} {
+		err := index.AddRow(&Row{Payload: json.RawMessage(document)})
+		biff.AssertNil(err)
+	}
+
+	err := index.RemoveRow(&Row{Payload: json.RawMessage(`{"year":1985}`)})
+	biff.AssertNil(err)
+
+	biff.AssertEqual(index.Btree.Len(), 1)
+}
+
 // TODO: remove this:
 func TestRRRR(t *testing.T) {
 
@@ -304,3 +379,52 @@ func TestSomething2(t *testing.T) {
 	}
 
 }
+
+func TestIndexBtree_NonUnique(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		err := c.Index("by-status", &IndexBTreeOptions{Fields: []string{"status"}})
+		biff.AssertNil(err)
+		rows := []*Row{}
+		for i, status := range []string{"open", "closed", "open", "draft", "open"} {
+			row, err := c.Insert(map[string]interface{}{"id": fmt.Sprint(i), "status": status})
+			biff.AssertNil(err)
+			rows = append(rows, row)
+		}
+
+		traverse := func(c *Collection, options string) []interface{} {
+			ids := []interface{}{}
+			c.indexes["by-status"].Traverse([]byte(options), func(row *Row) bool {
+				ids = append(ids, decodePayload(row)["id"])
+				return true
+			})
+			return ids
+		}
+
+		// Check, duplicated values by insertion
+		biff.AssertEqual(traverse(c, `{}`), []interface{}{"1", "3", "0", "2", "4"})
+		biff.AssertEqual(traverse(c, `{"reverse":true}`), []interface{}{"4", "2", "0", "3", "1"})
+		biff.AssertEqual(traverse(c, `{"from":{"status":"open"}}`), []interface{}{"0", "2", "4"})
+		biff.AssertEqual(traverse(c, `{"to":{"status":"open"}}`), []interface{}{"1", "3"})
+		biff.AssertEqual(traverse(c, `{"from":{"status":"draft"},"to":{"status":"open"}}`), []interface{}{"3"})
+		biff.AssertEqual(traverse(c, `{"reverse":true,"to":{"status":"open"}}`), []interface{}{"4", "2", "0", "3", "1"})
+		biff.AssertEqual(traverse(c, `{"reverse":true,"from":{"status":"draft"}}`), []interface{}{"4", "2", "0"})
+		biff.AssertEqual(traverse(c, `{"reverse":true,"from":{"status":"closed"},"to":{"status":"open"}}`), []interface{}{"4", "2", "0", "3"})
+
+		// Run
+		err = c.Patch(rows[2], map[string]interface{}{"status": "closed"})
+		biff.AssertNil(err)
+		err = c.Remove(rows[0])
+		biff.AssertNil(err)
+
+		// Check
+		biff.AssertEqual(traverse(c, `{}`), []interface{}{"1", "2", "3", "4"})
+		c.Close()
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		biff.AssertEqual(traverse(c, `{}`), []interface{}{"1", "2", "3", "4"})
+	})
+}
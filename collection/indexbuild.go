@@ -0,0 +1,273 @@
+package collection
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Index states
+const (
+	IndexBuilding = "building" // rows are being added, not used by queries yet
+	IndexReady    = "ready"
+	IndexFailed   = "failed" // could not be built, see IndexStatus.Error
+)
+
+// indexBuildBatch is the number of rows added to a building index each time it
+// takes the index lock, writers wait at most one batch
+const indexBuildBatch = 1000
+
+// indexBuild tracks the rows written while an index is being built
+type indexBuild struct {
+	mutex   *sync.Mutex
+	touched map[*Row]struct{}        // rows inserted, patched or removed meanwhile, protected by mutex
+	built   map[*Row]json.RawMessage // payload each row was indexed with
+}
+
+// IndexStatus describes an index of a collection
+type IndexStatus struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Options interface{} `json:"options"`
+	State   string      `json:"state"`
+	Error   string      `json:"error,omitempty"`
+}
+
+func newCollectionIndex(options interface{}) (*collectionIndex, error) {
+
+	index := &collectionIndex{}
+
+	switch value := options.(type) {
+	case *IndexMapOptions:
+		index.Type = "map"
+		index.Index = NewIndexSyncMap(value)
+		index.Options = value
+	case *IndexBTreeOptions:
+		index.Type = "btree"
+		index.Index = NewIndexBTree(value)
+		index.Options = value
+	default:
+		return nil, fmt.Errorf("unexpected options parameters, it should be [map|btree]")
+	}
+
+	return index, nil
+}
+
+// touch records a row written while the index is building. Caller must hold
+// indexesMutex (R).
+func (index *collectionIndex) touch(row *Row) {
+	if index.build == nil {
+		return // failed
+	}
+	index.build.mutex.Lock()
+	index.build.touched[row] = struct{}{}
+	index.build.mutex.Unlock()
+}
+
+// touched tells if a row has been written while the index is building
+func (index *collectionIndex) touched(row *Row) bool {
+	index.build.mutex.Lock()
+	defer index.build.mutex.Unlock()
+	_, touched := index.build.touched[row]
+	return touched
+}
+
+// IndexBackground creates an index with a name and returns while it is built,
+// see ListIndexes to follow its state. The index is persisted once it is
+// ready.
+func (c *Collection) IndexBackground(name string, options interface{}) error {
+	_, err := c.startIndex(name, options)
+	return err
+}
+
+// startIndex registers a building index and builds it in background
+func (c *Collection) startIndex(name string, options interface{}) (*collectionIndex, error) {
+
+	if c.closed() {
+		return nil, fmt.Errorf("collection is closed")
+	}
+
+	index, err := newCollectionIndex(options)
+	if err != nil {
+		return nil, err
+	}
+	index.state = IndexBuilding
+	index.build = &indexBuild{
+		mutex:   &sync.Mutex{},
+		touched: map[*Row]struct{}{},
+		built:   map[*Row]json.RawMessage{},
+	}
+	index.done = make(chan struct{})
+
+	c.indexesMutex.Lock()
+	defer c.indexesMutex.Unlock()
+
+	if _, exists := c.indexes[name]; exists {
+		return nil, fmt.Errorf("index '%s' already exists", name)
+	}
+	c.indexes[name] = index
+
+	// Rows written from now on are touched
+	c.rowsMutex.Lock()
+	rows := make([]*Row, len(c.Rows))
+	copy(rows, c.Rows)
+	c.rowsMutex.Unlock()
+
+	go c.buildIndex(name, index, rows)
+
+	return index, nil
+}
+
+// buildIndex adds rows to a building index in batches, then catches up with
+// the touched rows and makes it ready
+func (c *Collection) buildIndex(name string, index *collectionIndex, rows []*Row) {
+
+	defer close(index.done)
+
+	for start := 0; start < len(rows); start += indexBuildBatch {
+		end := start + indexBuildBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		c.indexesMutex.Lock()
+		if c.indexes[name] != index {
+			c.indexesMutex.Unlock()
+			return // dropped
+		}
+		for _, row := range rows[start:end] {
+			if !c.isLive(row) || index.touched(row) {
+				continue // caught up later
+			}
+			err := index.AddRow(row)
+			if err != nil {
+				c.failIndex(index, fmt.Errorf("index row: %s, data: %s", err.Error(), string(row.Payload)))
+				c.indexesMutex.Unlock()
+				return
+			}
+			index.build.built[row] = row.Payload
+		}
+		c.indexesMutex.Unlock()
+	}
+
+	// Persisted operations wait for the switch, so the index command is
+	// journaled before any write that relies on it
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
+
+	c.indexesMutex.Lock()
+	defer c.indexesMutex.Unlock()
+
+	if c.indexes[name] != index {
+		return // dropped
+	}
+
+	// Entries are removed by value, so every outdated one goes before adding
+	for row := range index.build.touched {
+		if payload, built := index.build.built[row]; built {
+			err := index.RemoveRow(&Row{Id: row.Id, Payload: payload})
+			if err != nil {
+				c.failIndex(index, fmt.Errorf("index remove: %s", err.Error()))
+				return
+			}
+		}
+	}
+	for row := range index.build.touched {
+		if !c.isLive(row) {
+			continue
+		}
+		err := index.AddRow(row)
+		if err != nil {
+			c.failIndex(index, fmt.Errorf("index row: %s, data: %s", err.Error(), string(row.Payload)))
+			return
+		}
+	}
+
+	payload, err := json.Marshal(&CreateIndexCommand{
+		Name:    name,
+		Type:    index.Type,
+		Options: index.Options,
+		Version: indexCommandVersion,
+	})
+	if err != nil {
+		c.failIndex(index, fmt.Errorf("json encode payload: %w", err))
+		return
+	}
+
+	command := &Command{
+		Name:      "index", // todo: rename to create_index
+		Uuid:      uuid.New().String(),
+		Timestamp: time.Now().UnixNano(),
+		StartByte: 0,
+		Payload:   payload,
+	}
+
+	err = c.EncodeCommand(command)
+	if err != nil {
+		c.failIndex(index, err)
+		return
+	}
+
+	index.state = IndexReady
+	index.build = nil
+}
+
+// failIndex marks a building index as failed. Caller must hold indexesMutex.
+func (c *Collection) failIndex(index *collectionIndex, err error) {
+	index.state = IndexFailed
+	index.err = err
+	index.build = nil
+}
+
+// isLive tells if a row has not been removed
+func (c *Collection) isLive(row *Row) bool {
+	c.rowsMutex.Lock()
+	defer c.rowsMutex.Unlock()
+	return c.rowsById[row.Id] == row
+}
+
+// Indexes returns the ready indexes
+func (c *Collection) Indexes() map[string]*collectionIndex {
+
+	c.indexesMutex.RLock()
+	defer c.indexesMutex.RUnlock()
+
+	result := make(map[string]*collectionIndex, len(c.indexes))
+	for name, index := range c.indexes {
+		if index.state == IndexReady {
+			result[name] = index
+		}
+	}
+
+	return result
+}
+
+// ListIndexes returns every index sorted by name, whatever its state
+func (c *Collection) ListIndexes() []*IndexStatus {
+
+	c.indexesMutex.RLock()
+	defer c.indexesMutex.RUnlock()
+
+	result := make([]*IndexStatus, 0, len(c.indexes))
+	for name, index := range c.indexes {
+		status := &IndexStatus{
+			Name:    name,
+			Type:    index.Type,
+			Options: index.Options,
+			State:   index.state,
+		}
+		if index.err != nil {
+			status.Error = index.err.Error()
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
@@ -0,0 +1,135 @@
+package collection
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/fulldump/biff"
+)
+
+func waitIndex(c *Collection, name string) *IndexStatus {
+	for {
+		for _, status := range c.ListIndexes() {
+			if status.Name == name && status.State != IndexBuilding {
+				return status
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIndexBackground_ConcurrentWrites(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		rows := []*Row{}
+		for i := 0; i < 5000; i++ {
+			row, _ := c.Insert(map[string]any{"id": strconv.Itoa(i)})
+			rows = append(rows, row)
+		}
+
+		// Run
+		err := c.IndexBackground("my-index", &IndexMapOptions{Field: "id"})
+		AssertNil(err)
+
+		wg := &sync.WaitGroup{}
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 5000; i < 6000; i++ {
+				c.Insert(map[string]any{"id": strconv.Itoa(i)})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Patch(rows[i], map[string]any{"id": "p" + strconv.Itoa(i)})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 4000; i < 5000; i++ {
+				c.Remove(rows[i])
+			}
+		}()
+		wg.Wait()
+
+		status := waitIndex(c, "my-index")
+
+		// Check
+		AssertEqual(status.State, IndexReady)
+		index := c.Indexes()["my-index"]
+		expected := map[string]int{}
+		for i := 0; i < 6000; i++ {
+			expected[strconv.Itoa(i)] = 1
+		}
+		for i := 0; i < 1000; i++ {
+			expected[strconv.Itoa(i)] = 0
+			expected["p"+strconv.Itoa(i)] = 1
+		}
+		for i := 4000; i < 5000; i++ {
+			expected[strconv.Itoa(i)] = 0
+		}
+		for id, n := range expected {
+			if findByIndex(index, `{"value":"`+id+`"}`, &map[string]any{}) != n {
+				t.Fatalf("id '%s' should be found %d times", id, n)
+			}
+		}
+		_, err = c.Insert(map[string]any{"id": "p1"})
+		AssertNotNil(err)
+	})
+}
+
+func TestIndexBackground_Failed(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Insert(map[string]any{"id": "1"})
+		c.Insert(map[string]any{"id": "1"})
+
+		// Run
+		err := c.IndexBackground("my-index", &IndexMapOptions{Field: "id"})
+		AssertNil(err)
+		status := waitIndex(c, "my-index")
+
+		// Check
+		AssertEqual(status.State, IndexFailed)
+		AssertNotEqual(status.Error, "")
+		AssertEqual(len(c.Indexes()), 0)
+		_, err = c.Insert(map[string]any{"id": "1"})
+		AssertNil(err) // failed indexes are not enforced
+
+		AssertNil(c.DropIndex("my-index"))
+		c.Close()
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqual(len(c.ListIndexes()), 0) // never persisted
+		AssertEqual(len(c.Rows), 3)
+	})
+}
+
+func TestIndex_WaitsUntilBuilt(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Insert(map[string]any{"id": "1"})
+
+		// Run
+		err := c.Index("my-index", &IndexMapOptions{Field: "id"})
+
+		// Check
+		AssertNil(err)
+		AssertEqual(c.ListIndexes()[0].State, IndexReady)
+		c.Close()
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqual(len(c.Indexes()), 1)
+	})
+}
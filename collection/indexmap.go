@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 // IndexMap should be an interface to allow multiple kinds and implementations
@@ -25,7 +27,7 @@ func (i *IndexMap) RemoveRow(row *Row) error {
 
 	item := map[string]interface{}{}
 
-	err := json.Unmarshal(row.Payload, &item)
+	err := utils.DecodeJSON(row.Payload, &item)
 	if err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
 	}
@@ -58,7 +60,7 @@ func (i *IndexMap) RemoveRow(row *Row) error {
 func (i *IndexMap) AddRow(row *Row) error {
 
 	item := map[string]interface{}{}
-	err := json.Unmarshal(row.Payload, &item)
+	err := utils.DecodeJSON(row.Payload, &item)
 	if err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
 	}
@@ -84,7 +86,7 @@ func (i *IndexMap) AddRow(row *Row) error {
 		_, exists := entries[value]
 		mutex.RUnlock()
 		if exists {
-			return fmt.Errorf("index conflict: field '%s' with value '%s'", field, value)
+			return newDuplicateKeyError("index conflict: field '%s' with value '%s'", field, value)
 		}
 
 		mutex.Lock()
@@ -95,7 +97,7 @@ func (i *IndexMap) AddRow(row *Row) error {
 		for _, v := range value {
 			s := v.(string) // TODO: handle this casting error
 			if _, exists := entries[s]; exists {
-				return fmt.Errorf("index conflict: field '%s' with value '%s'", field, value)
+				return newDuplicateKeyError("index conflict: field '%s' with value '%s'", field, value)
 			}
 		}
 		for _, v := range value {
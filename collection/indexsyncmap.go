@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 // IndexSyncMap should be an interface to allow multiple kinds and implementations
@@ -23,7 +25,7 @@ func (i *IndexSyncMap) RemoveRow(row *Row) error {
 
 	item := map[string]interface{}{}
 
-	err := json.Unmarshal(row.Payload, &item)
+	err := utils.DecodeJSON(row.Payload, &item)
 	if err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
 	}
@@ -56,7 +58,7 @@ func (i *IndexSyncMap) RemoveRow(row *Row) error {
 func (i *IndexSyncMap) AddRow(row *Row) error {
 
 	item := map[string]interface{}{}
-	err := json.Unmarshal(row.Payload, &item)
+	err := utils.DecodeJSON(row.Payload, &item)
 	if err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
 	}
@@ -78,14 +80,14 @@ func (i *IndexSyncMap) AddRow(row *Row) error {
 	case string:
 		_, exists := entries.Load(value)
 		if exists {
-			return fmt.Errorf("index conflict: field '%s' with value '%s'", field, value)
+			return newDuplicateKeyError("index conflict: field '%s' with value '%s'", field, value)
 		}
 		entries.Store(value, row)
 	case []interface{}:
 		for _, v := range value {
 			s := v.(string) // TODO: handle this casting error
 			if _, exists := entries.Load(s); exists {
-				return fmt.Errorf("index conflict: field '%s' with value '%s'", field, value)
+				return newDuplicateKeyError("index conflict: field '%s' with value '%s'", field, value)
 			}
 		}
 		for _, v := range value {
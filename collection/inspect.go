@@ -0,0 +1,162 @@
+package collection
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// JournalStats describes the content of a journal
+type JournalStats struct {
+	Files         []string                       `json:"files"`
+	Bytes         int64                          `json:"bytes"`
+	Commands      map[string]int64               `json:"commands"` // by name
+	Rows          int                            `json:"rows"`     // live rows
+	Indexes       map[string]*CreateIndexCommand `json:"indexes"`
+	Defaults      map[string]any                 `json:"defaults"`
+	Compression   string                         `json:"compression"`
+	SnapshotBytes int64                          `json:"snapshot_bytes"` // size once compacted
+	WastedBytes   int64                          `json:"wasted_bytes"`
+	Recovery      *RecoveryReport                `json:"recovery"`
+}
+
+// openDetached returns a collection that reads the journal of filename but
+// cannot write to it
+func openDetached(filename string, options *Options) (*Collection, error) {
+
+	readOptions := &Options{}
+	if options != nil {
+		readOptions.Keyring = options.Keyring
+		readOptions.Compression = options.Compression
+	}
+	collection := newCollection(filename, readOptions)
+
+	if readOptions.Keyring != nil && readOptions.Keyring.Current != nil {
+		var err error
+		collection.sealer, err = newSealer(readOptions.Keyring.Current)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key: %w", err)
+		}
+	}
+
+	manifest, err := readManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+	collection.manifest = manifest
+
+	return collection, nil
+}
+
+// ScanJournal passes every command of the journal of filename (all its
+// segments) to f, without modifying any file. Only the Keyring and Recovery
+// options are used.
+func ScanJournal(filename string, options *Options, f func(command *Command) error) (*RecoveryReport, error) {
+
+	collection, err := openDetached(filename, options)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := ""
+	if options != nil {
+		mode = options.Recovery
+	}
+
+	return collection.replayJournal(mode, f, false)
+}
+
+// ErrStopScan can be returned by the function passed to ScanJournal to stop
+// reading without error
+var ErrStopScan = errStopReplay
+
+// Inspect replays the journal of filename, without modifying any file, and
+// describes its content
+func Inspect(filename string, options *Options) (*JournalStats, error) {
+
+	collection, err := openDetached(filename, options)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &JournalStats{
+		Files:    collection.journalFiles(),
+		Bytes:    collection.journalSize(),
+		Commands: map[string]int64{},
+		Indexes:  map[string]*CreateIndexCommand{},
+	}
+
+	mode := ""
+	if options != nil {
+		mode = options.Recovery
+	}
+
+	stats.Recovery, _, err = collection.replayDeferred(mode, func(command *Command) error {
+		stats.Commands[command.Name]++
+		return collection.applyCommand(command)
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Rows = len(collection.Rows)
+	stats.Defaults = collection.Defaults
+	stats.Compression = collection.compression()
+	for name, index := range collection.indexes {
+		stats.Indexes[name] = &CreateIndexCommand{
+			Name:    name,
+			Type:    index.Type,
+			Options: index.Options,
+		}
+	}
+
+	stats.SnapshotBytes, err = collection.snapshotSize()
+	if err != nil {
+		return nil, err
+	}
+	if stats.Bytes > stats.SnapshotBytes {
+		stats.WastedBytes = stats.Bytes - stats.SnapshotBytes
+	}
+
+	return stats, nil
+}
+
+// snapshotSize returns the size of the journal after a compaction
+func (c *Collection) snapshotSize() (int64, error) {
+
+	c.commitMutex.Lock()
+	commands, err := c.snapshotCommands()
+	c.commitMutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	em := encPool.Get().(*EncoderMachine)
+	defer encPool.Put(em)
+
+	counter := &countingWriter{}
+	w := bufio.NewWriterSize(newJournalWriter(counter, c.compression(), c.sealer), 512*1024)
+	for _, command := range commands {
+		line, err := encodeCommandLine(em, command)
+		if err == nil {
+			_, err = w.Write(line)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("encode snapshot: %w", err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		return 0, fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	return counter.n, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,61 @@
+package collection
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestInspect(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Index("my-index", &IndexMapOptions{Field: "id"})
+		row, _ := c.Insert(map[string]interface{}{"id": "1"})
+		c.Insert(map[string]interface{}{"id": "2"})
+		c.Patch(row, map[string]interface{}{"name": "Pablo"})
+		c.Remove(row)
+		c.Close()
+		before, _ := os.ReadFile(filename)
+
+		// Run
+		stats, err := Inspect(filename, nil)
+
+		// Check
+		AssertNil(err)
+		AssertEqual(stats.Commands["insert"], int64(2))
+		AssertEqual(stats.Commands["patch"], int64(1))
+		AssertEqual(stats.Commands["remove"], int64(1))
+		AssertEqual(stats.Rows, 1)
+		AssertNotNil(stats.Indexes["my-index"])
+		AssertEqual(stats.Bytes, int64(len(before)))
+		AssertTrue(stats.WastedBytes > 0)
+
+		after, _ := os.ReadFile(filename)
+		AssertEqual(string(after), string(before))
+	})
+}
+
+func TestScanJournal_Stop(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		for i := 0; i < 10; i++ {
+			c.Insert(map[string]interface{}{"n": i})
+		}
+		c.Close()
+
+		n := 0
+		_, err := ScanJournal(filename, nil, func(command *Command) error {
+			n++
+			if n == 3 {
+				return ErrStopScan
+			}
+			return nil
+		})
+		AssertNil(err)
+		AssertEqual(n, 3)
+	})
+}
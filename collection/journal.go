@@ -0,0 +1,361 @@
+package collection
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+
+	json2 "github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// Journal format: one JSON command per line. Every line ends with a
+// `"checksum"` member holding the CRC-32C of the line without that member, so
+// that torn or garbled records can be detected. Lines without checksum
+// (written by older versions) are accepted as they are.
+
+// Recovery modes, applied when a journal contains invalid records
+const (
+	RecoveryStrict     = "strict"     // fail on any invalid record
+	RecoveryTruncate   = "truncate"   // truncate a torn tail, fail on invalid records in the middle
+	RecoverySkip       = "skip"       // truncate a torn tail, skip invalid records in the middle
+	RecoveryQuarantine = "quarantine" // like skip, but invalid records are copied into a quarantine file
+)
+
+// quarantineSuffix is appended to the collection filename to store the
+// invalid records found in RecoveryQuarantine mode
+const quarantineSuffix = ".quarantine"
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+var checksumMember = []byte(`,"checksum":`)
+
+type RecoveryReport struct {
+	Mode           string             `json:"mode"`
+	Commands       int64              `json:"commands"`
+	Bytes          int64              `json:"bytes"`
+	TruncatedBytes int64              `json:"truncated_bytes"`
+	Corrupted      []*CorruptedRecord `json:"corrupted"`
+	QuarantineFile string             `json:"quarantine_file,omitempty"`
+
+	stopped bool // replay was stopped by errStopReplay
+}
+
+type CorruptedRecord struct {
+	Segment string `json:"segment,omitempty"` // only for segmented journals
+	Offset  int64  `json:"offset"`
+	Length  int64  `json:"length"`
+	Error   string `json:"error"`
+}
+
+// ValidateRecovery returns an error if mode is not a known recovery mode
+func ValidateRecovery(mode string) error {
+	switch mode {
+	case "", RecoveryStrict, RecoveryTruncate, RecoverySkip, RecoveryQuarantine:
+		return nil
+	}
+	return fmt.Errorf("unexpected recovery '%s' instead of [%s|%s|%s|%s]",
+		mode, RecoveryStrict, RecoveryTruncate, RecoverySkip, RecoveryQuarantine)
+}
+
+// encodeCommandLine serializes a command as a journal line (checksum and
+// newline included). The result is only valid until em is reused.
+func encodeCommandLine(em *EncoderMachine, command *Command) ([]byte, error) {
+
+	em.Buffer.Reset()
+	err := json2.MarshalEncode(em.Enc2, command)
+	if err != nil {
+		return nil, err
+	}
+
+	line := bytes.TrimRight(em.Buffer.Bytes(), "\n")
+	sum := crc32.Checksum(line, checksumTable)
+
+	line = line[:len(line)-1] // strip closing '}'
+	line = append(line, checksumMember...)
+	line = strconv.AppendUint(line, uint64(sum), 10)
+	line = append(line, '}', '\n')
+
+	return line, nil
+}
+
+// verifyChecksum checks the checksum of a journal line (without newline)
+func verifyChecksum(line []byte) error {
+
+	i := bytes.LastIndex(line, checksumMember)
+	if i < 0 || !topLevel(line, i) {
+		return nil // legacy record, a checksum member belongs to the payload
+	}
+
+	if line[len(line)-1] != '}' {
+		return fmt.Errorf("malformed checksum")
+	}
+	digits := line[i+len(checksumMember) : len(line)-1]
+	expected, err := strconv.ParseUint(string(digits), 10, 32)
+	if err != nil {
+		return fmt.Errorf("malformed checksum '%s'", digits)
+	}
+
+	sum := crc32.Update(crc32.Checksum(line[:i], checksumTable), checksumTable, []byte{'}'})
+	if uint32(expected) != sum {
+		return fmt.Errorf("checksum mismatch: expected %d, obtained %d", expected, sum)
+	}
+
+	return nil
+}
+
+// topLevel tells if offset i of the JSON object line is a member of the object
+// itself, not of a nested value
+func topLevel(line []byte, i int) bool {
+	depth := 0
+	inString := false
+	for j := 0; j < i; j++ {
+		switch b := line[j]; {
+		case inString && b == '\\':
+			j++ // escaped character
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == '{' || b == '[':
+			depth++
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return depth == 1 && !inString
+}
+
+// errStopReplay can be returned by the apply function of readJournal to stop
+// reading without error
+var errStopReplay = errors.New("stop replay")
+
+// readJournal decodes every command from r and passes it to apply. Invalid
+// records are handled according to mode and described in the returned
+// report; errors from apply and missing encryption keys abort the read.
+// Invalid records at the end are a torn tail only if active is true (the
+// journal is still written), otherwise they are corrupted records.
+func readJournal(r io.Reader, filename, mode string, active bool, keyring *Keyring, apply func(command *Command) error) (*RecoveryReport, error) {
+
+	if mode == "" {
+		mode = RecoveryTruncate
+	}
+
+	report := &RecoveryReport{
+		Mode:      mode,
+		Corrupted: []*CorruptedRecord{},
+	}
+
+	var quarantine *os.File
+	defer func() {
+		if quarantine != nil {
+			quarantine.Close()
+		}
+	}()
+	toQuarantine := func(record []byte) error {
+		if mode != RecoveryQuarantine {
+			return nil
+		}
+		if quarantine == nil {
+			var err error
+			report.QuarantineFile = filename + quarantineSuffix
+			quarantine, err = os.OpenFile(report.QuarantineFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+			if err != nil {
+				return fmt.Errorf("open quarantine file: %w", err)
+			}
+		}
+		_, err := quarantine.Write(record)
+		return err
+	}
+
+	// Invalid records are pending until a valid one follows, otherwise they
+	// are a torn tail
+	pending := []*CorruptedRecord{}
+	pendingData := []byte{}
+
+	invalid := func(start int64, raw []byte, err error) error {
+		if mode == RecoveryStrict {
+			return fmt.Errorf("invalid record at byte %d: %s", start, err.Error())
+		}
+		pending = append(pending, &CorruptedRecord{
+			Offset: start,
+			Length: int64(len(raw)),
+			Error:  err.Error(),
+		})
+		pendingData = append(pendingData, raw...)
+		return nil
+	}
+
+	// process applies a record found at offset start, end is the offset that
+	// is valid once it has been applied
+	command := &Command{}
+	process := func(record []byte, start, end int64, raw []byte) error {
+
+		*command = Command{} // omitted fields must not keep the previous value
+		err := verifyChecksum(record)
+		if err == nil {
+			err = json2.Unmarshal(record, command,
+				jsontext.AllowDuplicateNames(true),
+				jsontext.AllowInvalidUTF8(true),
+			)
+		}
+		if err != nil {
+			return invalid(start, raw, err)
+		}
+
+		if len(pending) > 0 {
+			if mode == RecoveryTruncate {
+				return fmt.Errorf("invalid record at byte %d: %s", pending[0].Offset, pending[0].Error)
+			}
+			err := toQuarantine(pendingData)
+			if err != nil {
+				return err
+			}
+			report.Corrupted = append(report.Corrupted, pending...)
+			pending = pending[:0]
+			pendingData = pendingData[:0]
+		}
+
+		err = apply(command)
+		if err != nil {
+			return err
+		}
+		report.Commands++
+		report.Bytes = end
+
+		return nil
+	}
+
+	reader := bufio.NewReaderSize(r, 1024*1024)
+	line := []byte{}
+	offset := int64(0)
+
+	for {
+		var readErr error
+		line, readErr = readLine(reader, line)
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("read journal: %w", readErr)
+		}
+		if len(line) == 0 && readErr == io.EOF {
+			break
+		}
+
+		start := offset
+		offset += int64(len(line))
+
+		var err error
+		if bytes.HasPrefix(line, frameMarker) {
+			err = readFrame(reader, line, start, &offset, keyring, invalid, process)
+			if err == io.ErrUnexpectedEOF {
+				readErr, err = io.EOF, nil
+			}
+		} else if record := bytes.TrimSpace(line); len(record) == 0 {
+			if len(pending) == 0 {
+				report.Bytes = offset
+			}
+		} else {
+			err = process(record, start, offset, line)
+		}
+		if err == errStopReplay {
+			report.stopped = true
+			return report, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	// Torn tail
+	if len(pending) > 0 {
+		if !active && mode == RecoveryTruncate {
+			return nil, fmt.Errorf("invalid record at byte %d: %s", pending[0].Offset, pending[0].Error)
+		}
+		err := toQuarantine(pendingData)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			report.TruncatedBytes = offset - report.Bytes
+		} else {
+			report.Corrupted = append(report.Corrupted, pending...)
+			report.Bytes = offset // sealed segments are never truncated
+		}
+	}
+
+	return report, nil
+}
+
+// readFrame reads the frame whose header is line and processes every record
+// inside. A frame is valid or invalid as a whole. It returns
+// io.ErrUnexpectedEOF if the frame is torn.
+func readFrame(r *bufio.Reader, line []byte, start int64, offset *int64, keyring *Keyring,
+	invalid func(start int64, raw []byte, err error) error,
+	process func(record []byte, start, end int64, raw []byte) error) error {
+
+	header, err := parseFrameHeader(line)
+	if err != nil {
+		return invalid(start, line, err)
+	}
+
+	body, readErr := readFrameBody(r, header)
+	*offset += int64(len(body))
+	if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+		return fmt.Errorf("read journal: %w", readErr)
+	}
+
+	data, err := decodeFrame(header, body, keyring)
+	if errors.Is(err, ErrEncryptionKey) {
+		return err
+	}
+	if err != nil {
+		err = invalid(start, append(append([]byte{}, line...), body...), err)
+		if err == nil && readErr != nil {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			i = len(data) - 1
+		}
+		raw := data[:i+1]
+		data = data[i+1:]
+		record := bytes.TrimSpace(raw)
+		if len(record) == 0 {
+			continue
+		}
+		end := start
+		if len(data) == 0 {
+			end = *offset // the frame is valid once all its records are applied
+		}
+		err := process(record, start, end, raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readLine reads a full line (newline included) reusing buf
+func readLine(r *bufio.Reader, buf []byte) ([]byte, error) {
+	buf = buf[:0]
+	for {
+		chunk, err := r.ReadSlice('\n')
+		buf = append(buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return buf, err
+	}
+}
@@ -0,0 +1,129 @@
+package collection
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func writeJournal(filename string, documents ...string) []byte {
+
+	c, _ := OpenCollection(filename)
+	for _, document := range documents {
+		c.Insert(map[string]interface{}{"name": document})
+	}
+	c.Close()
+
+	content, _ := os.ReadFile(filename)
+	return content
+}
+
+func TestJournal_Checksum(t *testing.T) {
+	Environment(func(filename string) {
+
+		content := writeJournal(filename, "Pablo")
+
+		AssertTrue(bytes.Contains(content, []byte(`,"checksum":`)))
+		AssertNil(verifyChecksum(bytes.TrimSpace(content)))
+
+		garbled := bytes.Replace(content, []byte("Pablo"), []byte("Pable"), 1)
+		AssertNotNil(verifyChecksum(bytes.TrimSpace(garbled)))
+	})
+}
+
+func TestJournal_Legacy(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		os.WriteFile(filename, []byte(`{"name":"insert","uuid":"ec59a0e6-8fcb-4c1c-91e5-3dd7df6a0b80","timestamp":1648937091073939741,"start_byte":0,"payload":{"name":"Fulanez","checksum":33}}`), 0666)
+
+		// Run
+		c, err := OpenCollection(filename)
+
+		// Check
+		AssertNil(err)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 1)
+	})
+}
+
+func TestJournal_MalformedChecksum(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		content := writeJournal(filename, "Pablo", "Sara")
+		lines := bytes.SplitAfter(content, []byte("\n"))
+		i := bytes.LastIndex(lines[0], []byte(`,"checksum":`))
+		malformed := append([]byte{}, lines[0][:i]...)
+		malformed = append(malformed, `,"checksum":"abc"}`+"\n"...)
+		os.WriteFile(filename, append(malformed, lines[1]...), 0666)
+
+		// Run
+		_, errStrict := OpenCollectionWithOptions(filename, &Options{Recovery: RecoveryStrict})
+		c, err := OpenCollectionWithOptions(filename, &Options{Recovery: RecoverySkip})
+
+		// Check
+		AssertNotNil(verifyChecksum(bytes.TrimSpace(malformed)))
+		AssertNotNil(errStrict)
+		AssertNil(err)
+		defer c.Close()
+		AssertEqual(len(c.Rows), 1)
+		AssertEqual(len(c.Recovery.Corrupted), 1)
+	})
+}
+
+func TestJournal_TornTail(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		content := writeJournal(filename, "Pablo", "Sara")
+		torn := content[:len(content)-20]
+		os.WriteFile(filename, torn, 0666)
+
+		// Run
+		c, err := OpenCollection(filename)
+
+		// Check
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 1)
+		AssertEqual(c.Recovery.TruncatedBytes, int64(len(torn)-bytes.IndexByte(content, '\n')-1))
+		c.Insert(map[string]interface{}{"name": "Ana"})
+		c.Close()
+
+		c, err = OpenCollectionWithOptions(filename, &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 2)
+		c.Close()
+	})
+}
+
+func TestJournal_CorruptedMiddle(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		content := writeJournal(filename, "Pablo", "Sara", "Ana")
+		content = bytes.Replace(content, []byte("Sara"), []byte("Sora"), 1)
+		os.WriteFile(filename, content, 0666)
+		defer os.Remove(filename + quarantineSuffix)
+
+		// Run & check
+		_, err := OpenCollection(filename)
+		AssertNotNil(err)
+
+		c, err := OpenCollectionWithOptions(filename, &Options{Recovery: RecoverySkip})
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 2)
+		AssertEqual(len(c.Recovery.Corrupted), 1)
+		AssertEqual(c.Recovery.Corrupted[0].Offset, int64(bytes.IndexByte(content, '\n')+1))
+		AssertEqual(c.Recovery.TruncatedBytes, int64(0))
+		c.Close()
+
+		c, err = OpenCollectionWithOptions(filename, &Options{Recovery: RecoveryQuarantine})
+		AssertNil(err)
+		c.Close()
+		quarantined, _ := os.ReadFile(filename + quarantineSuffix)
+		AssertTrue(bytes.Contains(quarantined, []byte("Sora")))
+	})
+}
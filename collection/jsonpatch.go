@@ -0,0 +1,362 @@
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fulldump/inceptiondb/utils"
+)
+
+// ErrPatchTestFailed is returned when a "test" operation of a JSON Patch does
+// not match the document
+var ErrPatchTestFailed = errors.New("patch test failed")
+
+// jsonPatchOperation is an operation of a JSON Patch (RFC 6902)
+type jsonPatchOperation struct {
+	Op    string
+	Path  []string
+	From  []string
+	Value interface{}
+}
+
+// jsonPatchOperations returns the operations of a JSON Patch, or nil if patch
+// is not an operation list
+func jsonPatchOperations(patch interface{}) ([]*jsonPatchOperation, error) {
+
+	if _, ok := patch.([]interface{}); !ok {
+		return nil, nil
+	}
+
+	// Same types as a decoded payload, so that "test" can compare values
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("encode JSON Patch: %w", err)
+	}
+	list := []interface{}{}
+	err = utils.DecodeJSON(raw, &list)
+	if err != nil {
+		return nil, fmt.Errorf("decode JSON Patch: %w", err)
+	}
+
+	operations := make([]*jsonPatchOperation, 0, len(list))
+	for i, item := range list {
+		operation, err := parseJSONPatchOperation(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %s", ErrInvalidPatch, i, err)
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+func parseJSONPatchOperation(item interface{}) (*jsonPatchOperation, error) {
+
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object")
+	}
+
+	operation := &jsonPatchOperation{}
+	operation.Op, _ = fields["op"].(string)
+
+	var err error
+	operation.Path, err = parsePointer(fields["path"])
+	if err != nil {
+		return nil, fmt.Errorf("path: %w", err)
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		value, exists := fields["value"]
+		if !exists {
+			return nil, fmt.Errorf("'%s' requires a value", operation.Op)
+		}
+		operation.Value = value
+	case "move", "copy":
+		operation.From, err = parsePointer(fields["from"])
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unknown op '%v'", fields["op"])
+	}
+
+	return operation, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens
+func parsePointer(pointer interface{}) ([]string, error) {
+
+	s, ok := pointer.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON pointer")
+	}
+	if s == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("'%s' must start with '/'", s)
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// applyJSONPatch applies the operations of a JSON Patch to a copy of original,
+// a failing operation aborts the whole patch
+func applyJSONPatch(original interface{}, operations []*jsonPatchOperation) (interface{}, bool, error) {
+
+	document := cloneJSONValue(original)
+
+	for i, operation := range operations {
+		var err error
+		document, err = applyJSONPatchOperation(document, operation)
+		if errors.Is(err, ErrPatchTestFailed) {
+			return nil, false, fmt.Errorf("operation %d: %w", i, err)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: operation %d (%s): %s", ErrInvalidPatch, i, operation.Op, err)
+		}
+	}
+
+	if _, ok := document.(map[string]interface{}); !ok {
+		return nil, false, fmt.Errorf("%w: document must be an object", ErrInvalidPatch)
+	}
+
+	return document, !reflect.DeepEqual(original, document), nil
+}
+
+func applyJSONPatchOperation(document interface{}, operation *jsonPatchOperation) (interface{}, error) {
+
+	switch operation.Op {
+	case "add":
+		return pointerAdd(document, operation.Path, cloneJSONValue(operation.Value))
+	case "remove":
+		document, _, err := pointerRemove(document, operation.Path)
+		return document, err
+	case "replace":
+		if len(operation.Path) == 0 {
+			return cloneJSONValue(operation.Value), nil
+		}
+		document, _, err := pointerRemove(document, operation.Path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, operation.Path, cloneJSONValue(operation.Value))
+	case "move":
+		if isPrefix(operation.From, operation.Path) && len(operation.From) < len(operation.Path) {
+			return nil, fmt.Errorf("cannot move a value into itself")
+		}
+		document, value, err := pointerRemove(document, operation.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, operation.Path, value)
+	case "copy":
+		value, err := pointerGet(document, operation.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, operation.Path, cloneJSONValue(value))
+	case "test":
+		value, err := pointerGet(document, operation.Path)
+		if err != nil || !equalJSONValues(value, operation.Value) {
+			return nil, fmt.Errorf("%w: '%s' does not match", ErrPatchTestFailed, formatPointer(operation.Path))
+		}
+		return document, nil
+	}
+
+	return nil, fmt.Errorf("unknown op '%s'", operation.Op)
+}
+
+// hasNullMember tells if an object inside value has a null member, a merge
+// diff would remove it instead of setting it
+func hasNullMember(value interface{}) bool {
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			if item == nil || hasNullMember(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasNullMember(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatPointer(path []string) string {
+	s := ""
+	for _, token := range path {
+		s += "/" + strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+	}
+	return s
+}
+
+// arrayIndex parses the token of an array element, end allows "-" and the
+// length of the array (position to append)
+func arrayIndex(token string, length int, end bool) (int, error) {
+
+	if end && token == "-" {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	if i > length || (i == length && !end) {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func pointerGet(document interface{}, path []string) (interface{}, error) {
+
+	for i, token := range path {
+		switch node := document.(type) {
+		case map[string]interface{}:
+			value, exists := node[token]
+			if !exists {
+				return nil, fmt.Errorf("'%s' does not exist", formatPointer(path[:i+1]))
+			}
+			document = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			document = node[index]
+		default:
+			return nil, fmt.Errorf("'%s' does not exist", formatPointer(path[:i+1]))
+		}
+	}
+
+	return document, nil
+}
+
+// pointerAdd adds value at path and returns the resulting document, arrays are
+// replaced by a new slice in their parent
+func pointerAdd(document interface{}, path []string, value interface{}) (interface{}, error) {
+
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return document, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, 0, len(node)+1)
+		array = append(array, node[:index]...)
+		array = append(array, value)
+		array = append(array, node[index:]...)
+		return pointerReplace(document, path[:len(path)-1], array)
+	}
+
+	return nil, fmt.Errorf("'%s' is not an object or an array", formatPointer(path[:len(path)-1]))
+}
+
+// pointerReplace sets the existing value at path and returns the resulting
+// document
+func pointerReplace(document interface{}, path []string, value interface{}) (interface{}, error) {
+
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+
+	return document, nil
+}
+
+// pointerRemove removes the value at path and returns the resulting document
+// and the removed value
+func pointerRemove(document interface{}, path []string) (interface{}, interface{}, error) {
+
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	parent, err := pointerGet(document, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, exists := node[token]
+		if !exists {
+			return nil, nil, fmt.Errorf("'%s' does not exist", formatPointer(path))
+		}
+		delete(node, token)
+		return document, value, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		array := make([]interface{}, 0, len(node)-1)
+		array = append(array, node[:index]...)
+		array = append(array, node[index+1:]...)
+		document, err = pointerReplace(document, path[:len(path)-1], array)
+		return document, value, err
+	}
+
+	return nil, nil, fmt.Errorf("'%s' is not an object or an array", formatPointer(path[:len(path)-1]))
+}
@@ -0,0 +1,125 @@
+package collection
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestJSONPatch(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		row, _ := c.Insert(map[string]interface{}{
+			"id":    "1",
+			"tags":  []interface{}{"a", "b", "c"},
+			"a/b":   1,
+			"old":   "value",
+			"items": []interface{}{map[string]interface{}{"n": 1}, map[string]interface{}{"n": 2}},
+		})
+
+		// Run
+		err := c.Patch(row, []interface{}{
+			map[string]interface{}{"op": "test", "path": "/id", "value": "1"},
+			map[string]interface{}{"op": "add", "path": "/tags/1", "value": "x"},
+			map[string]interface{}{"op": "add", "path": "/tags/-", "value": "z"},
+			map[string]interface{}{"op": "remove", "path": "/tags/0"},
+			map[string]interface{}{"op": "replace", "path": "/a~1b", "value": 2},
+			map[string]interface{}{"op": "move", "from": "/old", "path": "/new"},
+			map[string]interface{}{"op": "copy", "from": "/items/1", "path": "/items/0"},
+			map[string]interface{}{"op": "replace", "path": "/items/2/n", "value": 3},
+		})
+		AssertNil(err)
+		c.Close()
+
+		// Check
+		expected := map[string]interface{}{
+			"id":    "1",
+			"tags":  []interface{}{"x", "b", "c", "z"},
+			"a/b":   2,
+			"new":   "value",
+			"items": []interface{}{map[string]interface{}{"n": 2}, map[string]interface{}{"n": 1}, map[string]interface{}{"n": 3}},
+		}
+		AssertEqualJson(decodePayload(row), expected)
+		AssertEqual(row.Revision, int64(2))
+
+		c, _ = OpenCollection(filename) // persisted as a replace command
+		defer c.Close()
+		AssertEqualJson(decodePayload(c.Rows[0]), expected)
+	})
+}
+
+func TestJSONPatch_Null(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		row, _ := c.Insert(map[string]interface{}{"id": "1", "b": 1})
+
+		// Run
+		err := c.Patch(row, []interface{}{
+			map[string]interface{}{"op": "add", "path": "/a", "value": nil},
+			map[string]interface{}{"op": "replace", "path": "/b", "value": map[string]interface{}{"c": nil}},
+		})
+		AssertNil(err)
+		c.Close()
+
+		// Check
+		expected := map[string]interface{}{
+			"id": "1",
+			"a":  nil,
+			"b":  map[string]interface{}{"c": nil},
+		}
+		AssertEqualJson(decodePayload(row), expected)
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqualJson(decodePayload(c.Rows[0]), expected)
+		AssertEqual(c.Rows[0].Revision, int64(2))
+	})
+}
+
+func TestJSONPatch_TestFails(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]interface{}{"id": "1", "stock": 3})
+
+		err := c.Patch(row, []interface{}{
+			map[string]interface{}{"op": "replace", "path": "/stock", "value": 2},
+			map[string]interface{}{"op": "test", "path": "/id", "value": "2"},
+		})
+
+		AssertTrue(errors.Is(err, ErrPatchTestFailed))
+		AssertEqualJson(decodePayload(row), map[string]interface{}{"id": "1", "stock": 3})
+		AssertEqual(row.Revision, int64(1))
+	})
+}
+
+func TestJSONPatch_Errors(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]interface{}{"id": "1", "tags": []interface{}{"a"}})
+
+		patches := [][]interface{}{
+			{map[string]interface{}{"op": "explode", "path": "/id"}},
+			{map[string]interface{}{"op": "add", "path": "id", "value": 1}},
+			{map[string]interface{}{"op": "add", "path": "/tags/5", "value": 1}},
+			{map[string]interface{}{"op": "remove", "path": "/missing"}},
+			{map[string]interface{}{"op": "replace", "path": "", "value": []interface{}{}}},
+			{map[string]interface{}{"op": "move", "from": "/tags", "path": "/tags/0"}},
+			{"not an operation"},
+		}
+		for _, patch := range patches {
+			err := c.Patch(row, patch)
+			AssertTrue(errors.Is(err, ErrInvalidPatch))
+		}
+
+		AssertEqual(row.Revision, int64(1))
+	})
+}
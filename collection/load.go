@@ -0,0 +1,114 @@
+package collection
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LoadStats describes how a collection was loaded from its journal
+type LoadStats struct {
+	Rows              int           `json:"rows"`
+	Indexes           int           `json:"indexes"`
+	Commands          int64         `json:"commands"`
+	Bytes             int64         `json:"bytes"`
+	Replay            time.Duration `json:"replay"`
+	IndexBuild        time.Duration `json:"index_build"`
+	Duration          time.Duration `json:"duration"`
+	CommandsPerSecond float64       `json:"commands_per_second"`
+	BytesPerSecond    float64       `json:"bytes_per_second"`
+}
+
+// replayDeferred replays the journal leaving the indexes empty, then builds
+// them in bulk from the resulting rows. Inserting every row in every index
+// while replaying would also pay for rows patched or removed later on.
+func (c *Collection) replayDeferred(mode string, apply func(command *Command) error, repair bool) (*RecoveryReport, *LoadStats, error) {
+
+	t0 := time.Now()
+
+	c.deferIndexes = true
+	report, err := c.replayJournal(mode, apply, repair)
+	c.deferIndexes = false
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.raiseSequencesToRows()
+
+	t1 := time.Now()
+	err = c.buildIndexes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats := &LoadStats{
+		Rows:       len(c.Rows),
+		Indexes:    len(c.indexes),
+		Commands:   report.Commands,
+		Bytes:      report.Bytes,
+		Replay:     t1.Sub(t0),
+		IndexBuild: time.Since(t1),
+		Duration:   time.Since(t0),
+	}
+	if seconds := stats.Duration.Seconds(); seconds > 0 {
+		stats.CommandsPerSecond = float64(stats.Commands) / seconds
+		stats.BytesPerSecond = float64(stats.Bytes) / seconds
+	}
+
+	return report, stats, nil
+}
+
+// buildIndexes adds every row to every index, one goroutine per index. An
+// index that cannot be built fails the load, so the collection is quarantined
+// instead of being served without it.
+func (c *Collection) buildIndexes() error {
+
+	mutex := &sync.Mutex{}
+	failed := map[string]error{}
+
+	wg := &sync.WaitGroup{}
+	for name, index := range c.indexes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, row := range c.Rows {
+				err := index.AddRow(row)
+				if err != nil {
+					mutex.Lock()
+					failed[name] = fmt.Errorf("index row: %s, data: %s", err.Error(), string(row.Payload))
+					mutex.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	names := make([]string, 0, len(failed))
+	for name := range failed {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf("build index '%s': %w", names[0], failed[names[0]])
+}
+
+// progressReader reports the bytes read from a journal, across all its files
+type progressReader struct {
+	r     io.Reader
+	read  int64
+	total int64
+	f     func(replayed, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	p.f(p.read, p.total)
+	return n, err
+}
@@ -0,0 +1,139 @@
+package collection
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestLoad_IndexesBuiltAfterReplay(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Index("my-index", &IndexMapOptions{Field: "id"})
+		first, _ := c.Insert(map[string]interface{}{"id": "1"})
+		second, _ := c.Insert(map[string]interface{}{"id": "2"})
+		c.Patch(first, map[string]interface{}{"id": "3"})
+		c.Remove(second)
+		c.Insert(map[string]interface{}{"id": "2"}) // reuses a removed value
+		c.Close()
+
+		// Run
+		c, err := OpenCollectionWithOptions(filename, &Options{Recovery: RecoveryStrict})
+		AssertNil(err)
+		defer c.Close()
+
+		// Check
+		AssertEqual(len(c.Rows), 2)
+		found := []string{}
+		for _, id := range []string{"1", "2", "3"} {
+			c.indexes["my-index"].Traverse([]byte(`{"value":"`+id+`"}`), func(row *Row) bool {
+				item := map[string]string{}
+				json.Unmarshal(row.Payload, &item)
+				found = append(found, item["id"])
+				return true
+			})
+		}
+		AssertEqual(found, []string{"2", "3"})
+
+		AssertNotNil(c.Load)
+		AssertEqual(c.Load.Rows, 2)
+		AssertEqual(c.Load.Indexes, 1)
+		AssertEqual(c.Load.Commands, int64(6))
+		AssertTrue(c.Load.Duration >= c.Load.Replay)
+	})
+}
+
+func TestLoad_UniqueAfterReplay(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		c.Index("my-index", &IndexMapOptions{Field: "id"})
+		c.Insert(map[string]interface{}{"id": "1"})
+		c.Close()
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		_, err := c.Insert(map[string]interface{}{"id": "1"})
+		AssertNotNil(err)
+		AssertEqual(len(c.Rows), 1)
+	})
+}
+
+func TestLoad_IndexBuildFails(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Insert(map[string]interface{}{"id": "1"})
+		c.Insert(map[string]interface{}{"id": "1"})
+		c.Close()
+		f, _ := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0666)
+		f.WriteString(`{"name":"index","payload":{"name":"my-index","type":"map","options":{"field":"id"}}}` + "\n")
+		f.Close()
+
+		// Run
+		_, err := OpenCollection(filename)
+
+		// Check
+		AssertNotNil(err)
+		AssertTrue(strings.Contains(err.Error(), "my-index"))
+	})
+}
+
+func TestLoad_LegacyBtreeUnique(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		os.WriteFile(filename, []byte(
+			`{"name":"index","payload":{"name":"by-id","type":"btree","options":{"fields":["id"],"sparse":false,"unique":false}}}`+"\n"+
+				`{"name":"insert","payload":{"id":"1"}}`+"\n"), 0666)
+
+		// Run
+		c, err := OpenCollection(filename)
+		AssertNil(err)
+		_, err = c.Insert(map[string]interface{}{"id": "1"})
+
+		// Check
+		AssertNotNil(err) // btree indexes used to be always unique
+		_, err = c.Compact()
+		AssertNil(err)
+		c.Close()
+		content, _ := os.ReadFile(filename)
+		AssertTrue(strings.Contains(string(content), `"unique":true},"version":2`)) // migrated
+
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		_, err = c.Insert(map[string]interface{}{"id": "1"})
+		AssertNotNil(err)
+		AssertEqual(len(c.Rows), 1)
+	})
+}
+
+func TestLoad_Progress(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollectionWithOptions(filename, &Options{SegmentSize: 1024})
+		for i := 0; i < 100; i++ {
+			c.Insert(map[string]interface{}{"n": i})
+		}
+		c.Close()
+
+		replayed, total := int64(0), int64(0)
+		c, err := OpenCollectionWithOptions(filename, &Options{
+			Progress: func(r, t int64) {
+				AssertTrue(r >= replayed)
+				replayed, total = r, t
+			},
+		})
+		AssertNil(err)
+		defer c.Drop()
+		AssertTrue(len(c.journalFiles()) > 1)
+		AssertEqual(total, c.JournalSize())
+		AssertEqual(replayed, total)
+	})
+}
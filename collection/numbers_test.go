@@ -0,0 +1,86 @@
+package collection
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestLargeNumbers(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.SetDefaults(map[string]any{"limit": json.Number("18446744073709551615")})
+		row, err := c.Insert(map[string]any{"id": "1", "n": json.Number("9007199254740993")})
+		AssertNil(err)
+
+		// Run
+		err = c.Patch(row, map[string]any{"$inc": map[string]any{"n": 2}, "$mul": map[string]any{"limit": 2}})
+		AssertNil(err)
+		err = c.Patch(row, map[string]any{"m": json.Number("9223372036854775809")})
+		AssertNil(err)
+		other, err := c.Insert(map[string]any{"id": "2"})
+		AssertNil(err)
+		c.Close()
+
+		// Check
+		expected := `{"id":"1","limit":36893488147419103230,"m":9223372036854775809,"n":9007199254740995}`
+		AssertEqual(string(row.Payload), expected)
+		AssertEqual(string(other.Payload), `{"id":"2","limit":18446744073709551615}`)
+
+		c, _ = OpenCollection(filename) // replayed exactly
+		defer c.Close()
+		AssertEqual(string(c.Rows[0].Payload), expected)
+		AssertEqual(string(c.Rows[1].Payload), `{"id":"2","limit":18446744073709551615}`)
+	})
+}
+
+func TestLargeNumbers_Btree(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.Index("by-n", &IndexBTreeOptions{Fields: []string{"n"}, Unique: true})
+		c.Insert(map[string]any{"id": "a", "n": json.Number("9007199254740993")})
+		c.Insert(map[string]any{"id": "b", "n": json.Number("9007199254740992")})
+		c.Insert(map[string]any{"id": "c", "n": json.Number("0.5")})
+		c.Insert(map[string]any{"id": "d", "n": json.Number("-1e30")})
+
+		// Run
+		_, err := c.Insert(map[string]any{"id": "e", "n": json.Number("0.50")})
+
+		// Check
+		AssertNotNil(err) // same number as "0.5"
+		ids := []interface{}{}
+		c.indexes["by-n"].Traverse([]byte(`{}`), func(row *Row) bool {
+			ids = append(ids, decodePayload(row)["id"])
+			return true
+		})
+		AssertEqual(ids, []interface{}{"d", "c", "b", "a"})
+	})
+}
+
+func TestLargeNumbers_JSONPatchTest(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]any{"n": json.Number("9007199254740993")})
+
+		err := c.Patch(row, []any{
+			map[string]any{"op": "test", "path": "/n", "value": 9007199254740992},
+			map[string]any{"op": "add", "path": "/tested", "value": true},
+		})
+		AssertNotNil(err)
+
+		err = c.Patch(row, []any{
+			map[string]any{"op": "test", "path": "/n", "value": json.Number("9007199254740993.0")},
+			map[string]any{"op": "add", "path": "/tested", "value": true},
+		})
+		AssertNil(err)
+		AssertEqual(string(row.Payload), `{"n":9007199254740993,"tested":true}`)
+	})
+}
@@ -0,0 +1,463 @@
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fulldump/inceptiondb/utils"
+)
+
+// ErrInvalidPatch is returned when the update operators of a patch cannot be
+// applied to a document
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// updateOperator applies an operator to the field path of a document with
+// the argument given in the patch
+type updateOperator func(document map[string]interface{}, path string, arg interface{}) error
+
+var updateOperatorsByName = map[string]updateOperator{
+	"$set":         operatorSet,
+	"$unset":       operatorUnset,
+	"$inc":         operatorInc,
+	"$mul":         operatorMul,
+	"$min":         operatorMin,
+	"$max":         operatorMax,
+	"$push":        operatorPush,
+	"$addToSet":    operatorAddToSet,
+	"$pull":        operatorPull,
+	"$rename":      operatorRename,
+	"$currentDate": operatorCurrentDate,
+}
+
+// updateOperators returns the operators of a patch, or nil if it is a merge
+// patch. Operators and fields cannot be mixed.
+func updateOperators(patch interface{}) (map[string]interface{}, error) {
+
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	operators := 0
+	for key := range fields {
+		if strings.HasPrefix(key, "$") {
+			operators++
+		}
+	}
+	if operators == 0 {
+		return nil, nil
+	}
+	if operators != len(fields) {
+		return nil, fmt.Errorf("%w: cannot mix update operators and fields", ErrInvalidPatch)
+	}
+
+	// Same types as a decoded payload
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("encode update operators: %w", err)
+	}
+	result := map[string]interface{}{}
+	err = utils.DecodeJSON(raw, &result)
+	if err != nil {
+		return nil, fmt.Errorf("decode update operators: %w", err)
+	}
+
+	return result, nil
+}
+
+// applyUpdateOperators applies update operators ($inc, $push...) to a copy of
+// original. Setting a field to null removes it, like in a merge patch. A field
+// cannot be changed twice, by itself or through its parents, so the result does
+// not depend on the order of the operators.
+func applyUpdateOperators(original interface{}, operators map[string]interface{}) (interface{}, bool, error) {
+
+	document, ok := cloneJSONValue(original).(map[string]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("%w: document is not an object", ErrInvalidPatch)
+	}
+
+	type updatedPath struct {
+		operator string
+		path     string
+	}
+	updated := []updatedPath{}
+
+	for _, name := range sortedKeys(operators) {
+		operator, exists := updateOperatorsByName[name]
+		if !exists {
+			return nil, false, fmt.Errorf("%w: unknown update operator '%s'", ErrInvalidPatch, name)
+		}
+		fields, ok := operators[name].(map[string]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("%w: update operator '%s' expects an object", ErrInvalidPatch, name)
+		}
+		for _, path := range sortedKeys(fields) {
+			err := operator(document, path, fields[path])
+			if err != nil {
+				return nil, false, fmt.Errorf("%w: %s '%s': %s", ErrInvalidPatch, name, path, err)
+			}
+
+			paths := []string{path}
+			if target, ok := fields[path].(string); ok && name == "$rename" {
+				paths = append(paths, target)
+			}
+			for _, path := range paths {
+				for _, previous := range updated {
+					if overlappingPaths(path, previous.path) {
+						return nil, false, fmt.Errorf("%w: %s '%s' conflicts with %s '%s'", ErrInvalidPatch, name, path, previous.operator, previous.path)
+					}
+				}
+			}
+			for _, path := range paths {
+				updated = append(updated, updatedPath{operator: name, path: path})
+			}
+		}
+	}
+
+	return document, !reflect.DeepEqual(original, document), nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// overlappingPaths tells if two field paths are the same or one contains the
+// other
+func overlappingPaths(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// lookupPath returns the object that holds the last key of a dotted path,
+// nil if it does not exist and create is false
+func lookupPath(document map[string]interface{}, path string, create bool) (map[string]interface{}, string, error) {
+
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return nil, "", fmt.Errorf("invalid field path")
+		}
+	}
+
+	for _, key := range keys[:len(keys)-1] {
+		next, exists := document[key]
+		if !exists || next == nil {
+			if !create {
+				return nil, "", nil
+			}
+			child := map[string]interface{}{}
+			document[key] = child
+			document = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("field '%s' is not an object", key)
+		}
+		document = child
+	}
+
+	return document, keys[len(keys)-1], nil
+}
+
+func setValue(parent map[string]interface{}, key string, value interface{}) {
+	if value == nil {
+		delete(parent, key)
+		return
+	}
+	parent[key] = value
+}
+
+func operatorSet(document map[string]interface{}, path string, arg interface{}) error {
+	parent, key, err := lookupPath(document, path, true)
+	if err != nil {
+		return err
+	}
+	setValue(parent, key, arg)
+	return nil
+}
+
+func operatorUnset(document map[string]interface{}, path string, arg interface{}) error {
+	parent, key, err := lookupPath(document, path, false)
+	if err != nil || parent == nil {
+		return err
+	}
+	delete(parent, key)
+	return nil
+}
+
+// arithmetic applies f to the number of a field, missing fields are zero.
+// Integers are exact whatever their size, decimals are float64.
+func arithmetic(document map[string]interface{}, path string, arg interface{}, ints func(current, arg *big.Int) *big.Int, floats func(current, arg float64) float64) error {
+
+	operand, ok := utils.ToNumber(arg)
+	if !ok {
+		return fmt.Errorf("%v is not a number", arg)
+	}
+
+	parent, key, err := lookupPath(document, path, true)
+	if err != nil {
+		return err
+	}
+
+	current := json.Number("0")
+	if value, exists := parent[key]; exists && value != nil {
+		current, ok = utils.ToNumber(value)
+		if !ok {
+			return fmt.Errorf("field is not a number")
+		}
+	}
+
+	x, okX := new(big.Int).SetString(string(current), 10)
+	y, okY := new(big.Int).SetString(string(operand), 10)
+	if okX && okY {
+		parent[key] = json.Number(ints(x, y).String())
+		return nil
+	}
+
+	a, err := current.Float64()
+	if err != nil {
+		return fmt.Errorf("field is not a number")
+	}
+	b, err := operand.Float64()
+	if err != nil {
+		return fmt.Errorf("%v is not a number", arg)
+	}
+	result := floats(a, b)
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return fmt.Errorf("result is out of range")
+	}
+	parent[key] = result
+	return nil
+}
+
+func operatorInc(document map[string]interface{}, path string, arg interface{}) error {
+	return arithmetic(document, path, arg, func(current, arg *big.Int) *big.Int {
+		return current.Add(current, arg)
+	}, func(current, arg float64) float64 {
+		return current + arg
+	})
+}
+
+func operatorMul(document map[string]interface{}, path string, arg interface{}) error {
+	return arithmetic(document, path, arg, func(current, arg *big.Int) *big.Int {
+		return current.Mul(current, arg)
+	}, func(current, arg float64) float64 {
+		return current * arg
+	})
+}
+
+// compareValues compares two numbers or two strings
+func compareValues(a, b interface{}) (int, error) {
+
+	if x, ok := utils.ToNumber(a); ok {
+		if y, ok := utils.ToNumber(b); ok {
+			return utils.CompareNumbers(x, y)
+		}
+	}
+
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %v with %v", a, b)
+}
+
+// replaceIf sets the field to arg if it is missing or replace returns true
+func replaceIf(document map[string]interface{}, path string, arg interface{}, replace func(cmp int) bool) error {
+
+	parent, key, err := lookupPath(document, path, true)
+	if err != nil {
+		return err
+	}
+
+	current, exists := parent[key]
+	if !exists || current == nil {
+		setValue(parent, key, arg)
+		return nil
+	}
+
+	cmp, err := compareValues(arg, current)
+	if err != nil {
+		return err
+	}
+	if replace(cmp) {
+		parent[key] = arg
+	}
+	return nil
+}
+
+func operatorMin(document map[string]interface{}, path string, arg interface{}) error {
+	return replaceIf(document, path, arg, func(cmp int) bool {
+		return cmp < 0
+	})
+}
+
+func operatorMax(document map[string]interface{}, path string, arg interface{}) error {
+	return replaceIf(document, path, arg, func(cmp int) bool {
+		return cmp > 0
+	})
+}
+
+// arrayArg returns the values of {"<modifier>": [...]} or the arg itself
+func arrayArg(arg interface{}, modifier string) ([]interface{}, error) {
+
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return []interface{}{arg}, nil
+	}
+	values, exists := m[modifier]
+	if !exists {
+		return []interface{}{arg}, nil
+	}
+	array, ok := values.([]interface{})
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("%s expects an array", modifier)
+	}
+	return array, nil
+}
+
+// arrayField returns the array of a field, missing fields are empty arrays
+func arrayField(document map[string]interface{}, path string, create bool) (map[string]interface{}, string, []interface{}, error) {
+
+	parent, key, err := lookupPath(document, path, create)
+	if err != nil || parent == nil {
+		return nil, "", nil, err
+	}
+
+	value, exists := parent[key]
+	if !exists || value == nil {
+		return parent, key, []interface{}{}, nil
+	}
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, "", nil, fmt.Errorf("field is not an array")
+	}
+	return parent, key, array, nil
+}
+
+func containsValue(array []interface{}, value interface{}) bool {
+	for _, item := range array {
+		if equalJSONValues(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func operatorPush(document map[string]interface{}, path string, arg interface{}) error {
+
+	values, err := arrayArg(arg, "$each")
+	if err != nil {
+		return err
+	}
+	parent, key, array, err := arrayField(document, path, true)
+	if err != nil {
+		return err
+	}
+
+	parent[key] = append(array, values...)
+	return nil
+}
+
+func operatorAddToSet(document map[string]interface{}, path string, arg interface{}) error {
+
+	values, err := arrayArg(arg, "$each")
+	if err != nil {
+		return err
+	}
+	parent, key, array, err := arrayField(document, path, true)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if !containsValue(array, value) {
+			array = append(array, value)
+		}
+	}
+	parent[key] = array
+	return nil
+}
+
+func operatorPull(document map[string]interface{}, path string, arg interface{}) error {
+
+	values, err := arrayArg(arg, "$in")
+	if err != nil {
+		return err
+	}
+	parent, key, array, err := arrayField(document, path, false)
+	if err != nil || parent == nil {
+		return err
+	}
+	if _, exists := parent[key]; !exists {
+		return nil
+	}
+
+	result := []interface{}{}
+	for _, item := range array {
+		if !containsValue(values, item) {
+			result = append(result, item)
+		}
+	}
+	parent[key] = result
+	return nil
+}
+
+func operatorRename(document map[string]interface{}, path string, arg interface{}) error {
+
+	target, ok := arg.(string)
+	if !ok {
+		return fmt.Errorf("expects a field name")
+	}
+	if overlappingPaths(target, path) {
+		return fmt.Errorf("cannot rename a field to itself, a child or a parent")
+	}
+
+	parent, key, err := lookupPath(document, path, false)
+	if err != nil || parent == nil {
+		return err
+	}
+	value, exists := parent[key]
+	if !exists {
+		return nil
+	}
+	delete(parent, key)
+
+	return operatorSet(document, target, value)
+}
+
+func operatorCurrentDate(document map[string]interface{}, path string, arg interface{}) error {
+
+	dateType := "date"
+	if arg != true {
+		m, _ := arg.(map[string]interface{})
+		dateType, _ = m["$type"].(string)
+		if len(m) != 1 {
+			dateType = ""
+		}
+	}
+
+	now := time.Now()
+	switch dateType {
+	case "date":
+		return operatorSet(document, path, now.UTC().Format(time.RFC3339Nano))
+	case "timestamp":
+		return operatorSet(document, path, now.UnixNano())
+	}
+
+	return fmt.Errorf(`expects true, {"$type":"date"} or {"$type":"timestamp"}`)
+}
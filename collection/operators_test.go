@@ -0,0 +1,170 @@
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func decodePayload(row *Row) map[string]interface{} {
+	document := map[string]interface{}{}
+	json.Unmarshal(row.Payload, &document)
+	return document
+}
+
+func TestUpdateOperators(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		row, _ := c.Insert(map[string]interface{}{
+			"id":     "1",
+			"n":      2,
+			"low":    5,
+			"high":   5,
+			"tags":   []interface{}{"a", "b"},
+			"old":    "value",
+			"remove": true,
+			"nested": map[string]interface{}{"count": 1},
+		})
+
+		// Run
+		err := c.Patch(row, map[string]interface{}{
+			"$inc":      map[string]interface{}{"n": 3, "nested.count": 1, "created": 1},
+			"$mul":      map[string]interface{}{"low": 2},
+			"$max":      map[string]interface{}{"high": 9},
+			"$push":     map[string]interface{}{"tags": map[string]interface{}{"$each": []interface{}{"c", "d"}}},
+			"$addToSet": map[string]interface{}{"set": "x"},
+			"$unset":    map[string]interface{}{"remove": ""},
+			"$rename":   map[string]interface{}{"old": "new"},
+		})
+		AssertNil(err)
+		err = c.Patch(row, map[string]interface{}{
+			"$min":      map[string]interface{}{"low": 1},
+			"$pull":     map[string]interface{}{"tags": map[string]interface{}{"$in": []interface{}{"a", "c"}}},
+			"$addToSet": map[string]interface{}{"set": map[string]interface{}{"$each": []interface{}{"x", "y"}}},
+		})
+		AssertNil(err)
+		c.Close()
+
+		// Check
+		expected := map[string]interface{}{
+			"id":      "1",
+			"n":       5,
+			"low":     1,
+			"high":    9,
+			"tags":    []interface{}{"b", "d"},
+			"set":     []interface{}{"x", "y"},
+			"new":     "value",
+			"created": 1,
+			"nested":  map[string]interface{}{"count": 2},
+		}
+		AssertEqualJson(decodePayload(row), expected)
+		AssertEqual(row.Revision, int64(3))
+
+		c, _ = OpenCollection(filename) // the diff is journaled
+		defer c.Close()
+		AssertEqualJson(decodePayload(c.Rows[0]), expected)
+		AssertEqual(c.Rows[0].Revision, int64(3))
+	})
+}
+
+func TestUpdateOperators_DollarFields(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		row, _ := c.Insert(map[string]interface{}{"id": "1"})
+		err := c.Patch(row, map[string]interface{}{"$set": map[string]interface{}{"$ref": "users"}})
+		AssertNil(err)
+		c.Close()
+
+		c, _ = OpenCollection(filename) // the diff is not taken as operators
+		defer c.Close()
+		AssertEqualJson(decodePayload(c.Rows[0]), map[string]interface{}{"id": "1", "$ref": "users"})
+	})
+}
+
+func TestUpdateOperators_CurrentDate(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]interface{}{"id": "1"})
+
+		err := c.Patch(row, map[string]interface{}{
+			"$currentDate": map[string]interface{}{
+				"date":      true,
+				"timestamp": map[string]interface{}{"$type": "timestamp"},
+			},
+		})
+		AssertNil(err)
+
+		document := decodePayload(row)
+		AssertTrue(strings.HasSuffix(document["date"].(string), "Z"))
+		AssertTrue(document["timestamp"].(float64) > 0)
+	})
+}
+
+func TestUpdateOperators_Errors(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]interface{}{"id": "1", "name": "Ana"})
+
+		patches := map[string]interface{}{
+			"mixed":   map[string]interface{}{"$inc": map[string]interface{}{"n": 1}, "name": "Anna"},
+			"unknown": map[string]interface{}{"$explode": map[string]interface{}{"n": 1}},
+			"type":    map[string]interface{}{"$inc": map[string]interface{}{"name": 1}},
+			"arg":     map[string]interface{}{"$inc": map[string]interface{}{"n": "one"}},
+			"array":   map[string]interface{}{"$push": map[string]interface{}{"name": "x"}},
+			"same":    map[string]interface{}{"$set": map[string]interface{}{"name": "Anna"}, "$unset": map[string]interface{}{"name": true}},
+			"parent":  map[string]interface{}{"$set": map[string]interface{}{"a.b": 1}, "$unset": map[string]interface{}{"a": true}},
+			"renamed": map[string]interface{}{"$rename": map[string]interface{}{"name": "n"}, "$inc": map[string]interface{}{"n": 1}},
+			"child":   map[string]interface{}{"$rename": map[string]interface{}{"name": "name.first"}},
+			"chain":   map[string]interface{}{"$rename": map[string]interface{}{"id": "name", "name": "n"}},
+		}
+		for _, patch := range patches {
+			err := c.Patch(row, patch)
+			AssertTrue(errors.Is(err, ErrInvalidPatch))
+		}
+
+		AssertEqualJson(decodePayload(row), map[string]interface{}{"id": "1", "name": "Ana"})
+		AssertEqual(row.Revision, int64(1))
+	})
+}
+
+func TestUpdateOperators_Concurrent(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]interface{}{"id": "1"})
+
+		// Run
+		n := 50
+		wg := &sync.WaitGroup{}
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Patch(row, map[string]interface{}{
+					"$inc":  map[string]interface{}{"counter": 1},
+					"$push": map[string]interface{}{"log": "x"},
+				})
+			}()
+		}
+		wg.Wait()
+
+		// Check
+		document := decodePayload(row)
+		AssertEqual(document["counter"], float64(n))
+		AssertEqual(len(document["log"].([]interface{})), n)
+		AssertEqual(row.Revision, int64(n+1))
+	})
+}
@@ -0,0 +1,93 @@
+package collection
+
+import (
+	"fmt"
+)
+
+// PointInTime identifies a past state of a collection. Commands are applied
+// up to Timestamp (unix nano, inclusive) or up to the command with Uuid
+// (inclusive). History prior to the last compaction is not available: asking
+// for it is an error.
+type PointInTime struct {
+	Timestamp int64  `json:"timestamp"`
+	Uuid      string `json:"uuid"`
+}
+
+// OpenCollectionAt replays the journal of filename up to the given point in
+// time. The result is read only: it is detached from the journal file.
+func OpenCollectionAt(filename string, at *PointInTime) (*Collection, error) {
+	return OpenCollectionAtWithOptions(filename, at, nil)
+}
+
+// OpenCollectionAtWithOptions is OpenCollectionAt for journals that need
+// options to be read, like the encryption keyring
+func OpenCollectionAtWithOptions(filename string, at *PointInTime, options *Options) (*Collection, error) {
+
+	if at == nil || (at.Timestamp == 0 && at.Uuid == "") {
+		return nil, fmt.Errorf("point in time requires timestamp or uuid")
+	}
+
+	collection, err := openDetached(filename, options)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	applied := 0
+	collection.Recovery, collection.Load, err = collection.replayDeferred(RecoverySkip, func(command *Command) error {
+		if at.Timestamp > 0 && command.Timestamp > at.Timestamp {
+			if applied == 0 {
+				return fmt.Errorf("point in time %d is before the first command of the journal (%d), history prior to the last compaction is not available", at.Timestamp, command.Timestamp)
+			}
+			return errStopReplay
+		}
+		applied++
+		err := collection.applyCommand(command)
+		if err != nil {
+			return err
+		}
+		if at.Uuid != "" && command.Uuid == at.Uuid {
+			found = true
+			return errStopReplay
+		}
+		return nil
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if at.Uuid != "" && !found {
+		return nil, fmt.Errorf("command '%s' not found", at.Uuid)
+	}
+
+	return collection, nil
+}
+
+// ImportSnapshot persists into c the current state of source: defaults,
+// indexes and rows. It is meant to materialize a read only collection into a
+// new one.
+func (c *Collection) ImportSnapshot(source *Collection) error {
+
+	source.commitMutex.Lock()
+	commands, err := source.snapshotCommands()
+	source.commitMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
+
+	for _, command := range commands {
+		err := c.applyCommand(command)
+		if err != nil {
+			return fmt.Errorf("apply '%s': %w", command.Name, err)
+		}
+		err = c.EncodeCommand(command)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package collection
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/fulldump/biff"
+)
+
+func readCommands(filename string) []*Command {
+
+	f, _ := os.Open(filename)
+	defer f.Close()
+
+	commands := []*Command{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		command := &Command{}
+		json.Unmarshal(scanner.Bytes(), command)
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+func TestOpenCollectionAt(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Index("my-index", &IndexMapOptions{
+			Field: "id",
+		})
+		row, _ := c.Insert(map[string]interface{}{"id": "1", "name": "Pablo"})
+		c.Insert(map[string]interface{}{"id": "2", "name": "Sara"})
+		c.Patch(row, map[string]interface{}{"name": "Jaime"})
+		c.Remove(row)
+		c.Close()
+		commands := readCommands(filename)
+
+		// Run: just before the patch
+		historical, err := OpenCollectionAt(filename, &PointInTime{Uuid: commands[2].Uuid})
+
+		// Check
+		AssertNil(err)
+		AssertEqual(len(historical.Rows), 2)
+		user := map[string]interface{}{}
+		findByIndex(historical.indexes["my-index"], `{"value":"1"}`, &user)
+		AssertEqual(user["name"], "Pablo")
+
+		_, err = historical.Insert(map[string]interface{}{"id": "3"})
+		AssertNotNil(err)
+
+		// Run: just after the patch
+		historical, err = OpenCollectionAt(filename, &PointInTime{Timestamp: commands[3].Timestamp})
+
+		// Check
+		AssertNil(err)
+		findByIndex(historical.indexes["my-index"], `{"value":"1"}`, &user)
+		AssertEqual(user["name"], "Jaime")
+
+		// Journal is untouched
+		c, _ = OpenCollection(filename)
+		AssertEqual(len(c.Rows), 1)
+		c.Close()
+	})
+}
+
+func TestOpenCollectionAt_NotFound(t *testing.T) {
+	Environment(func(filename string) {
+
+		writeJournal(filename, "Pablo")
+
+		_, err := OpenCollectionAt(filename, &PointInTime{Uuid: "invented"})
+		AssertNotNil(err)
+
+		_, err = OpenCollectionAt(filename, &PointInTime{})
+		AssertNotNil(err)
+	})
+}
+
+func TestOpenCollectionAt_BeforeCompaction(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Insert(map[string]interface{}{"id": "1"})
+		c.Close()
+		before := readCommands(filename)[0]
+		time.Sleep(time.Millisecond) // compacted commands are newer
+		c, _ = OpenCollection(filename)
+		_, err := c.Compact()
+		AssertNil(err)
+		c.Close()
+
+		// Run & check
+		_, err = OpenCollectionAt(filename, &PointInTime{Timestamp: before.Timestamp})
+		AssertNotNil(err)
+
+		_, err = OpenCollectionAt(filename, &PointInTime{Uuid: before.Uuid})
+		AssertNotNil(err)
+
+		historical, err := OpenCollectionAt(filename, &PointInTime{Timestamp: time.Now().UnixNano()})
+		AssertNil(err)
+		AssertEqual(len(historical.Rows), 1)
+	})
+}
+
+func TestImportSnapshot(t *testing.T) {
+	Environment(func(filename string) {
+		Environment(func(targetFilename string) {
+
+			// Setup
+			c, _ := OpenCollection(filename)
+			c.SetDefaults(map[string]any{"id": "uuid()"})
+			c.Index("my-index", &IndexMapOptions{
+				Field: "id",
+			})
+			c.Insert(map[string]interface{}{"id": "1", "name": "Pablo"})
+			c.Close()
+			commands := readCommands(filename)
+			historical, _ := OpenCollectionAt(filename, &PointInTime{Uuid: commands[len(commands)-1].Uuid})
+
+			// Run
+			target, _ := OpenCollection(targetFilename)
+			err := target.ImportSnapshot(historical)
+			target.Close()
+
+			// Check
+			AssertNil(err)
+			target, _ = OpenCollection(targetFilename)
+			defer target.Close()
+			AssertEqual(len(target.Rows), 1)
+			AssertEqual(len(target.indexes), 1)
+			AssertEqual(target.Defaults, map[string]any{"id": "uuid()"})
+		})
+	})
+}
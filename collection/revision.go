@@ -0,0 +1,66 @@
+package collection
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+var ErrRevisionMismatch = errors.New("revision mismatch")
+
+// checkRevision fails if the row is not at revision, zero means any revision
+func checkRevision(row *Row, revision int64) error {
+	if revision == 0 {
+		return nil
+	}
+	current := atomic.LoadInt64(&row.Revision)
+	if current != revision {
+		return fmt.Errorf("%w: document is at revision %d, not %d", ErrRevisionMismatch, current, revision)
+	}
+	return nil
+}
+
+// PatchRevision patches a row only if it is still at revision, otherwise it
+// fails with ErrRevisionMismatch. Zero means any revision.
+func (c *Collection) PatchRevision(row *Row, patch interface{}, revision int64) error {
+	return c.patchByRow(row, patch, revision, true)
+}
+
+// RemoveRevision removes a row only if it is still at revision, otherwise it
+// fails with ErrRevisionMismatch. Zero means any revision.
+func (c *Collection) RemoveRevision(row *Row, revision int64) error {
+	return c.removeByRow(row, revision, true)
+}
+
+// Document returns the payload of a row, with its revision in
+// Options.RevisionField if set
+func (c *Collection) Document(row *Row) json.RawMessage {
+
+	payload := row.Payload
+	field := c.options.RevisionField
+	if field == "" {
+		return payload
+	}
+
+	body := bytes.TrimLeft(payload, " \t\r\n")
+	if len(body) == 0 || body[0] != '{' {
+		return payload // not an object
+	}
+	body = bytes.TrimLeft(body[1:], " \t\r\n")
+
+	key, _ := json.Marshal(field)
+	document := make([]byte, 0, len(payload)+len(key)+22)
+	document = append(document, '{')
+	document = append(document, key...)
+	document = append(document, ':')
+	document = strconv.AppendInt(document, atomic.LoadInt64(&row.Revision), 10)
+	if len(body) > 0 && body[0] != '}' {
+		document = append(document, ',')
+	}
+	document = append(document, body...)
+
+	return document
+}
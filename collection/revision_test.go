@@ -0,0 +1,91 @@
+package collection
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestRevision_Preconditions(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]interface{}{"id": "1"})
+		AssertEqual(row.Revision, int64(1))
+
+		// Run
+		n := 10
+		failed := 0
+		mutex := &sync.Mutex{}
+		wg := &sync.WaitGroup{}
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := c.PatchRevision(row, map[string]interface{}{"n": i}, 1)
+				if errors.Is(err, ErrRevisionMismatch) {
+					mutex.Lock()
+					failed++
+					mutex.Unlock()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// Check
+		AssertEqual(failed, n-1) // only one writer wins
+		AssertEqual(row.Revision, int64(2))
+		AssertTrue(errors.Is(c.RemoveRevision(row, 1), ErrRevisionMismatch))
+		AssertEqual(len(c.Rows), 1)
+		AssertNil(c.RemoveRevision(row, 2))
+		AssertEqual(len(c.Rows), 0)
+	})
+}
+
+func TestRevision_Persistence(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		row, _ := c.Insert(map[string]interface{}{"id": "1"})
+		c.Patch(row, map[string]interface{}{"name": "Ana"})
+		c.Patch(row, map[string]interface{}{"name": "Anna"})
+		c.Patch(row, map[string]interface{}{"name": "Anna"}) // unchanged
+		c.Insert(map[string]interface{}{"id": "2"})
+		c.Close()
+
+		// Run
+		c, _ = OpenCollection(filename)
+		AssertEqual(c.Rows[0].Revision, int64(3))
+		_, err := c.Compact()
+		AssertNil(err)
+		c.Close()
+
+		// Check
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqual(c.Rows[0].Revision, int64(3))
+		AssertEqual(c.Rows[1].Revision, int64(1))
+	})
+}
+
+func TestRevision_Document(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollectionWithOptions(filename, &Options{RevisionField: "_rev"})
+		defer c.Close()
+
+		row, _ := c.Insert(map[string]interface{}{"id": "1", "_rev": 10})
+		AssertEqual(string(c.Document(row)), `{"_rev":1,"id":"1"}`)
+
+		c.Patch(row, map[string]interface{}{"_rev": 20})
+		AssertEqual(string(c.Document(row)), `{"_rev":1,"id":"1"}`) // not a change
+
+		empty, _ := c.Insert(map[string]interface{}{})
+		AssertEqual(string(c.Document(empty)), `{"_rev":1}`)
+	})
+}
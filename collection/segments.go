@@ -0,0 +1,381 @@
+package collection
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A journal can be split into segments. The collection file is always the
+// anchor of the collection (and its first segment until the first
+// compaction). When the journal is segmented, `<collection>.manifest` lists
+// the segments in replay order: `<collection>` and `<collection>.segment-NNNNNN`.
+// Writing the manifest is the commit point of rotations and compactions.
+
+const manifestSuffix = ".manifest"
+const segmentInfix = ".segment-"
+
+type Manifest struct {
+	Segments []*Segment `json:"segments"`
+}
+
+type Segment struct {
+	Name    string    `json:"name"` // file name, relative to the collection directory
+	Number  int       `json:"number"`
+	Created time.Time `json:"created"`
+	Closed  time.Time `json:"closed,omitzero"` // zero for the active segment
+	Bytes   int64     `json:"bytes"`           // only for closed segments
+}
+
+func isSegmentFile(filename string) bool {
+	i := strings.LastIndex(filename, segmentInfix)
+	if i < 0 {
+		return false
+	}
+	_, err := strconv.Atoi(filename[i+len(segmentInfix):])
+	return err == nil
+}
+
+func segmentFilename(filename string, number int) string {
+	if number == 0 {
+		return filename
+	}
+	return fmt.Sprintf("%s%s%06d", filename, segmentInfix, number)
+}
+
+func readManifest(filename string) (*Manifest, error) {
+
+	data, err := os.ReadFile(filename + manifestSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	manifest := &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	if len(manifest.Segments) == 0 {
+		return nil, fmt.Errorf("decode manifest: no segments")
+	}
+
+	return manifest, nil
+}
+
+// writeManifest replaces the manifest atomically
+func writeManifest(filename string, manifest *Manifest) error {
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+
+	tmp := filename + manifestSuffix + compactingSuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	err = os.Rename(tmp, filename+manifestSuffix)
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Collection) segmented() bool {
+	return c.options.SegmentSize > 0 || c.options.SegmentAge > 0
+}
+
+// JournalFiles returns the files of the journal in replay order
+func (c *Collection) JournalFiles() []string {
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+	return c.journalFiles()
+}
+
+func (c *Collection) journalFiles() []string {
+
+	if c.manifest == nil {
+		return []string{c.Filename}
+	}
+
+	dir := filepath.Dir(c.Filename)
+	files := make([]string, len(c.manifest.Segments))
+	for i, segment := range c.manifest.Segments {
+		files[i] = filepath.Join(dir, segment.Name)
+	}
+	return files
+}
+
+// loadManifest reads the manifest, creating it if segmentation is enabled,
+// and removes segment files that are not listed (leftovers of an
+// interrupted rotation or compaction)
+func (c *Collection) loadManifest() error {
+
+	manifest, err := readManifest(c.Filename)
+	if err != nil {
+		return err
+	}
+
+	if manifest == nil && c.segmented() {
+		manifest = &Manifest{
+			Segments: []*Segment{
+				{Name: filepath.Base(c.Filename), Number: 0, Created: time.Now()},
+			},
+		}
+		err := writeManifest(c.Filename, manifest)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.manifest = manifest
+	if manifest == nil {
+		return nil
+	}
+
+	listed := map[string]bool{}
+	for _, segment := range manifest.Segments {
+		listed[segment.Name] = true
+	}
+	dir := filepath.Dir(c.Filename)
+	entries, _ := os.ReadDir(dir)
+	prefix := filepath.Base(c.Filename) + segmentInfix
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !isSegmentFile(name) || listed[name] {
+			continue
+		}
+		orphan := filepath.Join(dir, name)
+		fmt.Printf("WARNING: removing orphan segment '%s'\n", orphan)
+		os.Remove(orphan)
+	}
+
+	return nil
+}
+
+// activeSegment returns the segment that receives the writes
+func (c *Collection) activeSegment() *Segment {
+	if c.manifest == nil {
+		return nil
+	}
+	return c.manifest.Segments[len(c.manifest.Segments)-1]
+}
+
+func (c *Collection) shouldRotate() bool {
+
+	active := c.activeSegment()
+	if active == nil || c.segmentBytes == 0 {
+		return false
+	}
+
+	if c.options.SegmentSize > 0 && c.segmentBytes >= c.options.SegmentSize {
+		return true
+	}
+
+	if c.options.SegmentAge > 0 && time.Since(active.Created) >= c.options.SegmentAge {
+		return true
+	}
+
+	return false
+}
+
+// rotate closes the active segment and starts a new one. Caller must hold
+// encoderMutex.
+func (c *Collection) rotate() error {
+
+	active := c.activeSegment()
+
+	_, err := c.sync()
+	if err != nil {
+		return err
+	}
+
+	next := &Segment{
+		Number:  active.Number + 1,
+		Created: time.Now(),
+	}
+	nextFilename := segmentFilename(c.Filename, next.Number)
+	next.Name = filepath.Base(nextFilename)
+
+	file, err := os.OpenFile(nextFilename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+
+	closed := *active
+	closed.Closed = next.Created
+	closed.Bytes = c.segmentBytes
+
+	manifest := &Manifest{
+		Segments: append(append([]*Segment{}, c.manifest.Segments[:len(c.manifest.Segments)-1]...), &closed, next),
+	}
+	err = writeManifest(c.Filename, manifest)
+	if err != nil {
+		file.Close()
+		os.Remove(nextFilename)
+		return err
+	}
+
+	c.manifest = manifest
+	c.file.Close()
+	c.file = file
+	c.buffer.Reset(c.journalWriter(file))
+	c.segmentBytes = 0
+
+	return nil
+}
+
+// replayJournal reads every segment of the journal in order and passes its
+// commands to apply. Only the last (active) segment can have a torn tail, it
+// is truncated only when repair is set.
+func (c *Collection) replayJournal(mode string, apply func(command *Command) error, repair bool) (*RecoveryReport, error) {
+
+	report := &RecoveryReport{
+		Mode:      mode,
+		Corrupted: []*CorruptedRecord{},
+	}
+
+	progress := &progressReader{
+		total: c.journalSize(),
+		f:     c.options.Progress,
+	}
+
+	files := c.journalFiles()
+	for i, filename := range files {
+
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("open file for read: %w", err)
+		}
+		var r io.Reader = f
+		if progress.f != nil {
+			progress.r = f
+			r = progress
+		}
+		segmentReport, err := readJournal(r, filename, mode, i == len(files)-1, c.options.Keyring, apply)
+		f.Close()
+		if err != nil {
+			if c.manifest != nil {
+				return nil, fmt.Errorf("segment '%s': %w", filepath.Base(filename), err)
+			}
+			return nil, err
+		}
+
+		report.Mode = segmentReport.Mode
+		report.Commands += segmentReport.Commands
+		report.Bytes += segmentReport.Bytes
+		report.TruncatedBytes += segmentReport.TruncatedBytes
+		for _, corrupted := range segmentReport.Corrupted {
+			if c.manifest != nil {
+				corrupted.Segment = filepath.Base(filename)
+			}
+			report.Corrupted = append(report.Corrupted, corrupted)
+		}
+		if segmentReport.QuarantineFile != "" {
+			report.QuarantineFile = segmentReport.QuarantineFile
+		}
+
+		if repair && segmentReport.TruncatedBytes > 0 {
+			fmt.Printf("WARNING: %s: truncating torn tail at byte %d (%d bytes)\n", filename, segmentReport.Bytes, segmentReport.TruncatedBytes)
+			err = os.Truncate(filename, segmentReport.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("truncate torn tail: %w", err)
+			}
+		}
+
+		if segmentReport.stopped {
+			report.stopped = true
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// replaceSegments makes the journal written in tmpFilename the only segment
+// and returns it open for append. Caller must hold encoderMutex.
+func (c *Collection) replaceSegments(tmpFilename string) (*os.File, error) {
+
+	previous := c.journalFiles()
+
+	next := &Segment{
+		Number:  c.activeSegment().Number + 1,
+		Created: time.Now(),
+	}
+	nextFilename := segmentFilename(c.Filename, next.Number)
+	next.Name = filepath.Base(nextFilename)
+
+	err := os.Rename(tmpFilename, nextFilename)
+	if err != nil {
+		return nil, fmt.Errorf("replace journal: %w", err)
+	}
+
+	manifest := &Manifest{Segments: []*Segment{next}}
+	err = writeManifest(c.Filename, manifest)
+	if err != nil {
+		os.Remove(nextFilename)
+		return nil, fmt.Errorf("replace journal: %w", err)
+	}
+	c.manifest = manifest
+
+	file, err := os.OpenFile(nextFilename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("open file for write: %w", err)
+	}
+
+	// The collection file is kept (empty) because it identifies the collection.
+	// It is replaced instead of truncated, so a backup still reading it keeps
+	// its content.
+	for _, filename := range previous {
+		if filename == c.Filename {
+			tmp := filename + compactingSuffix
+			if os.WriteFile(tmp, nil, 0666) == nil {
+				os.Rename(tmp, filename)
+			}
+			continue
+		}
+		os.Remove(filename)
+	}
+
+	return file, nil
+}
+
+// journalSize returns the size in bytes of all the journal files
+func (c *Collection) journalSize() int64 {
+	size := int64(0)
+	for _, filename := range c.journalFiles() {
+		if info, err := os.Stat(filename); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// JournalSize returns the size in bytes of all the journal files
+func (c *Collection) JournalSize() int64 {
+	c.encoderMutex.Lock()
+	defer c.encoderMutex.Unlock()
+	return c.journalSize()
+}
@@ -0,0 +1,158 @@
+package collection
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestSegments_Rotation(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		options := &Options{SegmentSize: 1024}
+		c, _ := OpenCollectionWithOptions(filename, options)
+		defer c.Drop()
+		for i := 0; i < 100; i++ {
+			c.Insert(map[string]interface{}{"n": i, "name": "Fulanez"})
+		}
+		c.Remove(c.Rows[0])
+		c.Close()
+
+		// Check
+		manifest, err := readManifest(filename)
+		AssertNil(err)
+		AssertTrue(len(manifest.Segments) > 1)
+		AssertEqual(manifest.Segments[0].Name, filename)
+		for _, segment := range manifest.Segments[:len(manifest.Segments)-1] {
+			AssertTrue(segment.Bytes >= options.SegmentSize)
+			AssertFalse(segment.Closed.IsZero())
+		}
+		AssertTrue(manifest.Segments[len(manifest.Segments)-1].Closed.IsZero())
+
+		c, err = OpenCollection(filename) // segmentation disabled, manifest still honored
+		AssertNil(err)
+		AssertEqual(len(c.Rows), 99)
+		AssertEqual(len(c.JournalFiles()), len(manifest.Segments))
+	})
+}
+
+func TestSegments_RotationByAge(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollectionWithOptions(filename, &Options{SegmentAge: time.Hour})
+		defer c.Drop()
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		AssertEqual(len(c.JournalFiles()), 1)
+
+		c.activeSegment().Created = time.Now().Add(-2 * time.Hour)
+		c.Insert(map[string]interface{}{"name": "Sara"})
+
+		AssertEqual(len(c.JournalFiles()), 2)
+	})
+}
+
+func TestSegments_Compact(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{SegmentSize: 512})
+		defer c.Drop()
+		for i := 0; i < 50; i++ {
+			c.Insert(map[string]interface{}{"n": i})
+		}
+		for len(c.Rows) > 10 {
+			c.Remove(c.Rows[0])
+		}
+		previous := c.JournalFiles()
+
+		// Run
+		_, err := c.Compact()
+		files := c.JournalFiles()
+		c.Insert(map[string]interface{}{"n": 50})
+		c.Close()
+
+		// Check
+		AssertNil(err)
+		AssertEqual(len(files), 1)
+		AssertNotEqual(files[0], filename)
+		for _, file := range previous[1:] {
+			_, err := os.Stat(file)
+			AssertTrue(os.IsNotExist(err))
+		}
+		info, _ := os.Stat(filename)
+		AssertEqual(info.Size(), int64(0))
+
+		c, _ = OpenCollection(filename)
+		AssertEqual(len(c.Rows), 11)
+	})
+}
+
+func TestSegments_Orphan(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{SegmentSize: 1})
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		c.Close()
+		orphan := segmentFilename(filename, 99)
+		os.WriteFile(orphan, []byte(`{"name":"insert","payload":{"name":"Ghost"}}`+"\n"), 0666)
+
+		// Run
+		c, err := OpenCollection(filename)
+
+		// Check
+		AssertNil(err)
+		defer c.Drop()
+		AssertEqual(len(c.Rows), 1)
+		_, err = os.Stat(orphan)
+		AssertTrue(os.IsNotExist(err))
+	})
+}
+
+func TestSegments_TornSealedSegment(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollectionWithOptions(filename, &Options{SegmentSize: 1})
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		c.Insert(map[string]interface{}{"name": "Sara"})
+		c.Close()
+		content, _ := os.ReadFile(filename) // first segment, already sealed
+		torn := content[:len(content)-20]
+		os.WriteFile(filename, torn, 0666)
+
+		// Run & check
+		_, err := OpenCollection(filename)
+		AssertNotNil(err)
+
+		c, err = OpenCollectionWithOptions(filename, &Options{Recovery: RecoverySkip})
+		AssertNil(err)
+		defer c.Drop()
+		AssertEqual(len(c.Rows), 1)
+		AssertEqual(len(c.Recovery.Corrupted), 1)
+		AssertEqual(c.Recovery.TruncatedBytes, int64(0))
+		kept, _ := os.ReadFile(filename)
+		AssertEqual(len(kept), len(torn))
+	})
+}
+
+func TestSegments_Drop(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollectionWithOptions(filename, &Options{SegmentSize: 1})
+		c.Insert(map[string]interface{}{"name": "Pablo"})
+		c.Insert(map[string]interface{}{"name": "Sara"})
+		files := c.JournalFiles()
+
+		err := c.Drop()
+
+		AssertNil(err)
+		for _, file := range append(files, filename+manifestSuffix) {
+			_, err := os.Stat(file)
+			AssertTrue(os.IsNotExist(err))
+		}
+	})
+}
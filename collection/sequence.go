@@ -0,0 +1,200 @@
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fulldump/inceptiondb/utils"
+)
+
+// Sequences are named counters used by the `auto()` (sequence "default") and
+// `auto(<name>)` defaults. The values taken by an insert are journaled with
+// it, so sequences survive restarts and compactions.
+
+const defaultSequence = "default"
+
+type Sequence struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"` // last value taken, the next one is Value+1
+}
+
+type SetSequenceCommand struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// nextSequence takes the next value of a sequence
+func (c *Collection) nextSequence(name string) int64 {
+	c.sequencesMutex.Lock()
+	defer c.sequencesMutex.Unlock()
+	c.sequences[name]++
+	return c.sequences[name]
+}
+
+// raiseSequence makes sure the next value of a sequence is above value
+func (c *Collection) raiseSequence(name string, value int64) {
+	c.sequencesMutex.Lock()
+	defer c.sequencesMutex.Unlock()
+	if value > c.sequences[name] {
+		c.sequences[name] = value
+	}
+}
+
+// raiseSequencesToRows raises every sequence used by the defaults to the
+// values already stored in its fields, for journals written before sequences
+// were persisted and for values set by hand
+func (c *Collection) raiseSequencesToRows() {
+
+	fields := []*defaultValue{}
+	for _, d := range c.defaultValues {
+		if d.Sequence != "" {
+			fields = append(fields, d)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	for _, row := range c.Rows {
+		item := map[string]interface{}{}
+		utils.DecodeJSON(row.Payload, &item) // todo: handle error
+		for _, d := range fields {
+			value, _ := getPath(item, d.Path)
+			if n, ok := d.parseSequenceValue(value); ok {
+				c.raiseSequence(d.Sequence, n)
+			}
+		}
+	}
+}
+
+// Sequences returns the sequences sorted by name
+func (c *Collection) Sequences() []*Sequence {
+
+	c.sequencesMutex.Lock()
+	defer c.sequencesMutex.Unlock()
+
+	result := make([]*Sequence, 0, len(c.sequences))
+	for name, value := range c.sequences {
+		result = append(result, &Sequence{Name: name, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// SetSequence sets the last value taken of a sequence, the next insert gets
+// value+1. Values already taken by a unique index are skipped on insert.
+func (c *Collection) SetSequence(name string, value int64) error {
+
+	if name == "" {
+		return fmt.Errorf("sequence name is required")
+	}
+
+	// inserts in flight are journaled before this command
+	c.commitMutex.Lock()
+	defer c.commitMutex.Unlock()
+
+	c.setSequence(name, value)
+
+	payload, err := json.Marshal(&SetSequenceCommand{
+		Name:  name,
+		Value: value,
+	})
+	if err != nil {
+		return fmt.Errorf("json encode payload: %w", err)
+	}
+
+	command := &Command{
+		Name:      "set_sequence",
+		Uuid:      uuid.New().String(),
+		Timestamp: time.Now().UnixNano(),
+		StartByte: 0,
+		Payload:   payload,
+	}
+
+	return c.EncodeCommand(command)
+}
+
+func (c *Collection) setSequence(name string, value int64) {
+	c.sequencesMutex.Lock()
+	c.sequences[name] = value
+	c.sequencesMutex.Unlock()
+}
+
+// takeSequences sets the generated fields of item with the next value of their
+// sequence, fields with the same sequence get the same value
+func (c *Collection) takeSequences(item map[string]any, generated []*defaultValue) (map[string]int64, error) {
+
+	if len(generated) == 0 {
+		return nil, nil
+	}
+
+	values := map[string]int64{}
+	for _, d := range generated {
+		value, taken := values[d.Sequence]
+		if !taken {
+			value = c.nextSequence(d.Sequence)
+			values[d.Sequence] = value
+		}
+		err := setPath(item, d.Path, d.sequenceValue(value))
+		if err != nil {
+			return nil, fmt.Errorf("default '%s': %w", d.Path, err)
+		}
+	}
+
+	return values, nil
+}
+
+// maxGeneratedAttempts bounds the generated values tried by an insert when they
+// are already taken (by documents written with explicit values)
+const maxGeneratedAttempts = 1000
+
+// generatedConflict tells if err is a duplicate key in an index on a generated
+// field
+func (c *Collection) generatedConflict(err error, generated []*defaultValue) bool {
+
+	conflict := &IndexConflictError{}
+	if len(generated) == 0 || !errors.As(err, &conflict) || !errors.Is(err, ErrDuplicateKey) {
+		return false
+	}
+
+	c.indexesMutex.RLock()
+	index, exists := c.indexes[conflict.Index]
+	c.indexesMutex.RUnlock()
+	if !exists {
+		return false
+	}
+
+	for _, d := range generated {
+		if indexCovers(index, d.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// indexCovers tells if a field is part of the key of an index
+func indexCovers(index *collectionIndex, field string) bool {
+
+	switch options := index.Options.(type) {
+	case *IndexMapOptions:
+		return options.Field == field
+	case *IndexBTreeOptions:
+		for _, f := range options.Fields {
+			if strings.TrimPrefix(f, "-") == field {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package collection
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestSequence_Restart(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.SetDefaults(map[string]any{"id": "auto()"})
+		c.Insert(map[string]any{})
+		c.Insert(map[string]any{})
+		c.Close()
+
+		// Run
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		row, err := c.Insert(map[string]any{})
+
+		// Check
+		AssertNil(err)
+		AssertEqualJson(decodePayload(row), map[string]any{"id": 3})
+		AssertEqualJson(c.Sequences(), []*Sequence{{Name: "default", Value: 3}})
+	})
+}
+
+func TestSequence_Named(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.SetDefaults(map[string]any{"id": "auto(orders)", "number": "auto(orders)", "line": "auto(lines)"})
+
+		c.Insert(map[string]any{})
+		row, _ := c.Insert(map[string]any{"line": 10})
+
+		AssertEqualJson(decodePayload(row), map[string]any{"id": 2, "number": 2, "line": 10})
+		AssertEqualJson(c.Sequences(), []*Sequence{{Name: "lines", Value: 1}, {Name: "orders", Value: 2}})
+	})
+}
+
+func TestSequence_ResetSkipsTakenValues(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.SetDefaults(map[string]any{"id": "auto()"})
+		c.Index("by-id", &IndexBTreeOptions{Fields: []string{"id"}, Unique: true})
+		c.Insert(map[string]any{})
+		c.Insert(map[string]any{})
+		c.Insert(map[string]any{"id": 4})
+
+		// Run
+		err := c.SetSequence("default", 0)
+		AssertNil(err)
+		row, err := c.Insert(map[string]any{})
+		AssertNil(err)
+		AssertEqualJson(decodePayload(row), map[string]any{"id": 3})
+		row, err = c.Insert(map[string]any{})
+		AssertNil(err)
+		AssertEqualJson(decodePayload(row), map[string]any{"id": 5})
+		c.SetSequence("default", 100)
+		c.Close()
+
+		// Check
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		AssertEqualJson(c.Sequences(), []*Sequence{{Name: "default", Value: 100}})
+	})
+}
+
+func TestSequence_IndexErrorNotRetried(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.SetDefaults(map[string]any{"id": "auto()"})
+		c.Index("by-id", &IndexMapOptions{Field: "id"}) // only strings
+
+		// Run
+		_, err := c.Insert(map[string]any{})
+
+		// Check
+		AssertNotNil(err)
+		AssertFalse(errors.Is(err, ErrDuplicateKey))
+		AssertEqual(len(c.Rows), 0)
+		AssertEqualJson(c.Sequences(), []*Sequence{{Name: "default", Value: 1}})
+	})
+}
+
+func TestSequence_Compaction(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.SetDefaults(map[string]any{"id": "auto()"})
+		c.Insert(map[string]any{})
+		last, _ := c.Insert(map[string]any{})
+		c.Remove(last)
+
+		// Run
+		_, err := c.Compact()
+		AssertNil(err)
+		c.Close()
+
+		// Check
+		c, _ = OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]any{})
+		AssertEqualJson(decodePayload(row), map[string]any{"id": 3}) // removed values are not reused
+	})
+}
+
+func TestSequence_LegacyJournal(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup, written before sequences were persisted
+		os.WriteFile(filename, []byte(`{"name":"set_defaults","uuid":"1","timestamp":1,"start_byte":0,"payload":{"id":"auto()"}}
+{"name":"insert","uuid":"2","timestamp":2,"start_byte":0,"payload":{"id":1}}
+{"name":"insert","uuid":"3","timestamp":3,"start_byte":0,"payload":{"id":2}}
+`), 0666)
+
+		// Run
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		row, _ := c.Insert(map[string]any{})
+
+		// Check
+		AssertEqualJson(decodePayload(row), map[string]any{"id": 3})
+	})
+}
@@ -0,0 +1,170 @@
+package collection
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fulldump/inceptiondb/utils"
+)
+
+// ErrDocumentNotFound is returned by Replace when no document has the key
+var ErrDocumentNotFound = errors.New("document not found")
+
+// Upsert inserts item, or replaces the document with the same key in the
+// unique index if it exists. It tells if item has been inserted.
+func (c *Collection) Upsert(index string, item map[string]any) (*Row, bool, error) {
+	return c.writeByKey(index, item, true)
+}
+
+// Replace replaces the document with the same key as item in the unique
+// index, it fails with ErrDocumentNotFound if there is none
+func (c *Collection) Replace(index string, item map[string]any) (*Row, error) {
+	row, _, err := c.writeByKey(index, item, false)
+	return row, err
+}
+
+func (c *Collection) writeByKey(index string, item map[string]any, insert bool) (*Row, bool, error) {
+
+	if c.closed() {
+		return nil, false, fmt.Errorf("collection is closed")
+	}
+
+	if c.options.RevisionField != "" {
+		delete(item, c.options.RevisionField) // not part of the document
+	}
+
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return nil, false, fmt.Errorf("json encode payload: %w", err)
+	}
+	document := map[string]interface{}{}
+	err = utils.DecodeJSON(payload, &document) // same types as indexed payloads
+	if err != nil {
+		return nil, false, fmt.Errorf("json decode payload: %w", err)
+	}
+
+	// upserts on the same index are serialized, so a missing key cannot be
+	// inserted twice
+	c.indexesMutex.RLock()
+	keyIndex, exists := c.indexes[index]
+	c.indexesMutex.RUnlock()
+	if exists {
+		keyIndex.keyMutex.Lock()
+		defer keyIndex.keyMutex.Unlock()
+	}
+
+	for {
+		row, err := c.replaceByKey(index, document, payload)
+		if err != nil || row != nil {
+			return row, false, err
+		}
+		if !insert {
+			return nil, false, ErrDocumentNotFound
+		}
+
+		row, err = c.Insert(cloneJSONValue(item).(map[string]any))
+		conflict := &IndexConflictError{}
+		if errors.As(err, &conflict) && conflict.Index == index && errors.Is(err, ErrDuplicateKey) {
+			continue // inserted meanwhile, replace it
+		}
+		return row, err == nil, err
+	}
+}
+
+// replaceByKey replaces the payload of the row with the key of document, it
+// returns nil if there is no such row
+func (c *Collection) replaceByKey(index string, document map[string]interface{}, payload json.RawMessage) (*Row, error) {
+
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
+
+	for {
+		var base int64
+		unchanged := false
+		c.indexesMutex.RLock()
+		row, err := c.lookupKey(index, document)
+		if row != nil {
+			base = atomic.LoadInt64(&row.Revision)
+			unchanged = bytes.Equal(row.Payload, payload)
+		}
+		c.indexesMutex.RUnlock()
+		if err != nil || row == nil {
+			return nil, err
+		}
+		if unchanged {
+			return row, nil
+		}
+
+		command := &Command{
+			Name:      "replace",
+			Uuid:      uuid.New().String(),
+			Timestamp: time.Now().UnixNano(),
+			StartByte: 0,
+			RowId:     row.Id,
+			Payload:   payload,
+		}
+		applied, err := c.swapPayload(row, payload, base, 0, command)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			return row, c.commitCommand()
+		}
+		// written meanwhile, look the key up again
+	}
+}
+
+// lookupKey returns the row indexed under the key of document in a unique
+// index, nil if there is none. indexesMutex must be held.
+func (c *Collection) lookupKey(name string, document map[string]interface{}) (*Row, error) {
+
+	index, exists := c.indexes[name]
+	if !exists {
+		return nil, fmt.Errorf("index '%s' not found", name)
+	}
+	if index.state != IndexReady {
+		return nil, fmt.Errorf("index '%s' is %s, it cannot be used yet", name, index.state)
+	}
+
+	switch index := index.Index.(type) {
+	case *IndexSyncMap:
+		field := index.Options.Field
+		value, ok := document[field].(string)
+		if !ok {
+			return nil, fmt.Errorf("key field '%s' must be a string", field)
+		}
+		row, exists := index.Entries.Load(value)
+		if !exists {
+			return nil, nil
+		}
+		return row.(*Row), nil
+
+	case *IndexBtree:
+		if !index.Options.Unique {
+			return nil, fmt.Errorf("index '%s' is not unique", name)
+		}
+		key := &RowOrdered{}
+		for _, field := range index.Options.Fields {
+			field = strings.TrimPrefix(field, "-")
+			value := document[field]
+			if value == nil {
+				return nil, fmt.Errorf("key field '%s' not defined", field)
+			}
+			key.Values = append(key.Values, value)
+		}
+		found, exists := index.Btree.Get(key)
+		if !exists {
+			return nil, nil
+		}
+		return found.Row, nil
+	}
+
+	return nil, fmt.Errorf("index '%s' cannot be used as a key", name)
+}
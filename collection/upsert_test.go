@@ -0,0 +1,133 @@
+package collection
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestUpsert(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		c.Index("by-email", &IndexMapOptions{Field: "email"})
+
+		// Run
+		row, inserted, err := c.Upsert("by-email", map[string]any{"email": "ana@example.com", "name": "Ana", "age": 30})
+		AssertNil(err)
+		AssertTrue(inserted)
+
+		same, inserted, err := c.Upsert("by-email", map[string]any{"email": "ana@example.com", "name": "Anna", "nick": nil})
+		AssertNil(err)
+		AssertEqual(inserted, false)
+		AssertEqual(same, row)
+
+		_, err = c.Replace("by-email", map[string]any{"email": "bob@example.com"})
+		AssertTrue(errors.Is(err, ErrDocumentNotFound))
+		c.Close()
+
+		// Check
+		expected := map[string]interface{}{"email": "ana@example.com", "name": "Anna", "nick": nil}
+		AssertEqual(len(c.Rows), 1)
+		AssertEqualJson(decodePayload(row), expected)
+		AssertEqual(row.Revision, int64(2))
+
+		c, _ = OpenCollection(filename) // journaled as a replace command
+		defer c.Close()
+		AssertEqual(len(c.Rows), 1)
+		AssertEqualJson(decodePayload(c.Rows[0]), expected)
+		AssertEqual(c.Rows[0].Revision, int64(2))
+	})
+}
+
+func TestUpsert_Btree(t *testing.T) {
+	Environment(func(filename string) {
+
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.Index("by-day", &IndexBTreeOptions{Fields: []string{"city", "day"}, Unique: true})
+		c.Index("sorted", &IndexBTreeOptions{Fields: []string{"temp"}})
+
+		_, _, err := c.Upsert("by-day", map[string]any{"city": "Madrid", "day": 1, "temp": 20})
+		AssertNil(err)
+		_, _, err = c.Upsert("by-day", map[string]any{"city": "Paris", "day": 1, "temp": 15})
+		AssertNil(err)
+		_, err = c.Replace("by-day", map[string]any{"city": "Madrid", "day": 1, "temp": 25})
+		AssertNil(err)
+
+		AssertEqual(len(c.Rows), 2)
+		AssertEqualJson(decodePayload(c.Rows[0]), map[string]interface{}{"city": "Madrid", "day": 1, "temp": 25})
+
+		_, _, err = c.Upsert("sorted", map[string]any{"temp": 2})
+		AssertNotNil(err) // not unique
+		_, _, err = c.Upsert("by-day", map[string]any{"city": "Rome"})
+		AssertNotNil(err) // incomplete key
+		_, _, err = c.Upsert("missing", map[string]any{"city": "Rome"})
+		AssertNotNil(err)
+	})
+}
+
+func TestUpsert_Concurrent(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.Index("by-id", &IndexMapOptions{Field: "id"})
+
+		// Run
+		n := 20
+		wg := &sync.WaitGroup{}
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, _, err := c.Upsert("by-id", map[string]any{"id": fmt.Sprint(i % 2), "writer": i})
+				AssertNil(err)
+			}(i)
+		}
+		wg.Wait()
+
+		// Check
+		AssertEqual(len(c.Rows), 2)
+		revisions := c.Rows[0].Revision + c.Rows[1].Revision
+		AssertEqual(revisions, int64(n))
+	})
+}
+
+func TestUpsert_ConcurrentNewKey(t *testing.T) {
+	Environment(func(filename string) {
+
+		// Setup
+		c, _ := OpenCollection(filename)
+		defer c.Close()
+		c.Index("by-day", &IndexBTreeOptions{Fields: []string{"day"}, Unique: true})
+
+		// Run
+		inserts := int64(0)
+		wg := &sync.WaitGroup{}
+		for day := 0; day < 50; day++ {
+			for writer := 0; writer < 2; writer++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, inserted, err := c.Upsert("by-day", map[string]any{"day": day, "writer": writer})
+					AssertNil(err)
+					if inserted {
+						atomic.AddInt64(&inserts, 1)
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		// Check
+		AssertEqual(len(c.Rows), 50)
+		AssertEqual(inserts, int64(50))
+	})
+}
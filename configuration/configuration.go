@@ -1,13 +1,27 @@
 package configuration
 
+import "time"
+
 type Configuration struct {
-	HttpAddr          string `usage:"HTTP address"`
-	HttpsEnabled      bool   `usage:""`
-	HttpsSelfsigned   bool   `usage:""`
-	Dir               string `usage:"data directory"`
-	Statics           string `usage:"statics directory"`
-	Version           bool   `usage:"show version and exit"`
-	ShowBanner        bool   `usage:"show big banner"`
-	ShowConfig        bool   `usage:"print config"`
-	EnableCompression bool   `usage:"enable http compression (gzip)"`
+	HttpAddr          string        `usage:"HTTP address"`
+	HttpsEnabled      bool          `usage:""`
+	HttpsSelfsigned   bool          `usage:""`
+	Dir               string        `usage:"data directory"`
+	Statics           string        `usage:"statics directory"`
+	Version           bool          `usage:"show version and exit"`
+	ShowBanner        bool          `usage:"show big banner"`
+	ShowConfig        bool          `usage:"print config"`
+	EnableCompression bool          `usage:"enable http compression (gzip)"`
+	CompactAfter      int64         `usage:"compact a collection journal after this number of commands (0 disables it)"`
+	Durability        string        `usage:"journal durability for every write: buffered | flush | fsync | group"`
+	Recovery          string        `usage:"what to do with invalid journal records on load: strict | truncate | skip | quarantine"`
+	SegmentSize       int64         `usage:"rotate the journal into a new segment after this number of bytes (0 disables it)"`
+	SegmentAge        time.Duration `usage:"rotate the journal into a new segment after this time (0 disables it)"`
+	Compression       string        `usage:"journal compression for collections without their own: none | deflate"`
+	EncryptionKey     string        `usage:"base64 AES key (16, 24 or 32 bytes) to encrypt journals, better set with the environment variable ENCRYPTIONKEY"`
+	EncryptionKeyFile string        `usage:"file with the base64 AES key to encrypt journals"`
+	EncryptionOldKeys string        `usage:"comma separated base64 keys replaced by a key rotation, still accepted to read journals"`
+	LoadWorkers       int           `usage:"number of collections loaded in parallel on start (0 means one per CPU)"`
+	Restore           string        `usage:"backup archive (tar) to extract into the data directory, which must be empty, before starting"`
+	RevisionField     string        `usage:"field that exposes the revision of every returned document, like _rev (empty disables it)"`
 }
@@ -6,5 +6,8 @@ func Default() *Configuration {
 		HttpAddr:          "127.0.0.1:8080",
 		ShowBanner:        true,
 		EnableCompression: false,
+		Durability:        "buffered",
+		Recovery:          "truncate",
+		Compression:       "none",
 	}
 }
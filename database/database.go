@@ -1,12 +1,16 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fulldump/inceptiondb/collection"
@@ -19,13 +23,18 @@ const (
 )
 
 type Config struct {
-	Dir string
+	Dir               string
+	CollectionOptions *collection.Options
+	LoadWorkers       int // collections opened in parallel by Load, zero means one per CPU
 }
 
 type Database struct {
 	Config      *Config
 	status      string
-	Collections map[string]*collection.Collection
+	collections map[string]*entry              // ready collections, protected by mutex
+	progress    map[string]*CollectionProgress // state of every collection, protected by mutex
+	mutex       *sync.RWMutex
+	createMutex *sync.Mutex // serializes the creation of collections
 	exit        chan struct{}
 }
 
@@ -33,7 +42,10 @@ func NewDatabase(config *Config) *Database { // todo: return error?
 	s := &Database{
 		Config:      config,
 		status:      StatusOpening,
-		Collections: map[string]*collection.Collection{},
+		collections: map[string]*entry{},
+		progress:    map[string]*CollectionProgress{},
+		mutex:       &sync.RWMutex{},
+		createMutex: &sync.Mutex{},
 		exit:        make(chan struct{}),
 	}
 
@@ -44,87 +56,162 @@ func (db *Database) GetStatus() string {
 	return db.status
 }
 
-func (db *Database) CreateCollection(name string) (*collection.Collection, error) {
+// Load opens every collection of the data directory. The database is
+// operating as soon as the collections are found, each one serves requests
+// once it is loaded. Collections that cannot be loaded are quarantined, the
+// rest of the database keeps working.
+func (db *Database) Load() error {
 
-	_, exists := db.Collections[name]
-	if exists {
-		return nil, fmt.Errorf("collection '%s' already exists", name)
+	fmt.Printf("Loading database %s...\n", db.Config.Dir) // todo: move to logger
+	t0 := time.Now()
+	dir := db.Config.Dir
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
 	}
 
-	filename := path.Join(db.Config.Dir, name)
-	col, err := collection.OpenCollection(filename)
+	filenames := []string{}
+	err = filepath.WalkDir(dir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if collection.IsAuxiliaryFile(filename) {
+			fmt.Printf("WARNING: ignoring file '%s'\n", filename) // todo: move to logger
+			return nil
+		}
+		filenames = append(filenames, filename)
+		db.setState(db.collectionName(filename), CollectionLoading, nil)
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		db.status = StatusClosing
+		return err
 	}
 
-	db.Collections[name] = col
+	db.status = StatusOperating
 
-	return col, nil
-}
+	workers := db.Config.LoadWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
 
-func (db *Database) DropCollection(name string) error { // TODO: rename drop?
+	pending := make(chan string)
+	quarantined := int64(0)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filename := range pending {
+				err := db.loadCollection(db.collectionName(filename), "")
+				if err != nil {
+					atomic.AddInt64(&quarantined, 1)
+				}
+			}
+		}()
+	}
+	for _, filename := range filenames {
+		pending <- filename
+	}
+	close(pending)
+	wg.Wait()
 
-	col, exists := db.Collections[name]
-	if !exists {
-		return fmt.Errorf("collection '%s' not found", name)
+	if quarantined > 0 {
+		fmt.Printf("WARNING: %d collections quarantined\n", quarantined) // todo: move to logger
 	}
 
-	filename := path.Join(db.Config.Dir, name)
+	fmt.Printf("Ready: %d collections in %s\n", len(filenames), time.Since(t0)) // todo: move to logger
 
-	err := os.Remove(filename)
-	if err != nil {
-		return err // TODO: wrap?
-	}
+	return nil
 
-	delete(db.Collections, name) // TODO: protect section! not threadsafe
+}
 
-	return col.Close()
+func (db *Database) collectionName(filename string) string {
+	name := filename
+	name = strings.TrimPrefix(name, db.Config.Dir)
+	name = strings.TrimPrefix(name, "/")
+	return name
 }
 
-func (db *Database) Load() error {
+// loadCollection opens a collection, quarantining it on error. A non empty
+// recovery overrides the recovery mode of the database.
+func (db *Database) loadCollection(name, recovery string) error {
 
-	fmt.Printf("Loading database %s...\n", db.Config.Dir) // todo: move to logger
-	dir := db.Config.Dir
-	err := os.MkdirAll(dir, 0755)
+	filename := path.Join(db.Config.Dir, name)
+
+	options := &collection.Options{}
+	if db.Config.CollectionOptions != nil {
+		*options = *db.Config.CollectionOptions
+	}
+	if recovery != "" {
+		options.Recovery = recovery
+	}
+	options.Progress = func(replayed, total int64) {
+		db.setProgress(name, func(p *CollectionProgress) {
+			p.ReplayedBytes = replayed
+			p.Bytes = total
+		})
+	}
+
+	col, err := collection.OpenCollectionWithOptions(filename, options)
 	if err != nil {
+		hint := ""
+		if errors.Is(err, collection.ErrEncryptionKey) {
+			hint = " (check --encryptionkey, --encryptionkeyfile and --encryptionoldkeys)"
+		}
+		fmt.Printf("ERROR: open collection '%s': %s%s\n", filename, err.Error(), hint) // todo: move to logger
+		err = fmt.Errorf("open collection '%s': %w", name, err)
+		db.setState(name, CollectionQuarantined, err)
 		return err
 	}
-	err = filepath.WalkDir(dir, func(filename string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
 
-		name := filename
-		name = strings.TrimPrefix(name, dir)
-		name = strings.TrimPrefix(name, "/")
+	options.Progress = nil // only while loading
 
-		t0 := time.Now()
-		col, err := collection.OpenCollection(filename)
-		if err != nil {
-			fmt.Printf("ERROR: open collection '%s': %s\n", filename, err.Error()) // todo: move to logger
-			return err
-		}
-		fmt.Println(name, len(col.Rows), time.Since(t0)) // todo: move to logger
+	load := col.Load
+	fmt.Printf("%s: %d rows, %d commands, %d bytes in %s (replay %s, indexes %s), %.0f commands/s, %.1f MB/s\n",
+		name, load.Rows, load.Commands, load.Bytes, load.Duration, load.Replay, load.IndexBuild,
+		load.CommandsPerSecond, load.BytesPerSecond/1024/1024) // todo: move to logger
 
-		db.Collections[name] = col
+	db.register(name, col)
 
-		return nil
-	})
+	return nil
+}
 
-	if err != nil {
-		db.status = StatusClosing
-		return err
-	}
+// RecoverCollection loads again a quarantined collection, usually once its
+// journal has been fixed. A non empty recovery overrides the recovery mode of
+// the database, to skip the invalid records for example.
+func (db *Database) RecoverCollection(name, recovery string) (*collection.Collection, error) {
 
-	fmt.Println("Ready")
+	if recovery != "" {
+		err := collection.ValidateRecovery(recovery)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	db.status = StatusOperating
+	db.mutex.Lock()
+	p, exists := db.progress[name]
+	if !exists || p.State != CollectionQuarantined {
+		db.mutex.Unlock()
+		return nil, fmt.Errorf("collection '%s' is not quarantined", name)
+	}
+	db.progress[name] = &CollectionProgress{
+		Name:  name,
+		State: CollectionLoading,
+		Start: time.Now(),
+	}
+	db.mutex.Unlock()
 
-	return nil
+	err := db.loadCollection(name, recovery)
+	if err != nil {
+		return nil, err
+	}
 
+	col, _ := db.GetCollection(name)
+	return col, nil
 }
 
 func (db *Database) Start() error {
@@ -143,7 +230,8 @@ func (db *Database) Stop() error {
 	db.status = StatusClosing
 
 	var lastErr error
-	for name, col := range db.Collections {
+	for name, col := range db.ListCollections() {
+		db.setState(name, CollectionClosing, nil)
 		fmt.Printf("Closing '%s'...\n", name)
 		err := col.Close()
 		if err != nil {
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	CollectionLoading     = "loading"
+	CollectionReady       = "ready"
+	CollectionQuarantined = "quarantined" // failed to load, see Error
+	CollectionClosing     = "closing"
+)
+
+// CollectionProgress is the lifecycle state of a collection, only collections
+// in state CollectionReady serve requests
+type CollectionProgress struct {
+	Name          string        `json:"name"`
+	State         string        `json:"state"`
+	Bytes         int64         `json:"bytes"` // journal size, known once the replay starts
+	ReplayedBytes int64         `json:"replayed_bytes"`
+	Start         time.Time     `json:"start"`
+	Duration      time.Duration `json:"duration"` // loading time
+	Error         string        `json:"error,omitempty"`
+}
+
+// Remaining estimates the time to finish loading from the throughput so far
+func (p *CollectionProgress) Remaining() time.Duration {
+
+	if p.State != CollectionLoading || p.ReplayedBytes == 0 {
+		return 0
+	}
+
+	elapsed := time.Since(p.Start)
+	pending := p.Bytes - p.ReplayedBytes
+	if pending <= 0 {
+		return 0 // building indexes
+	}
+
+	return time.Duration(float64(elapsed) * float64(pending) / float64(p.ReplayedBytes))
+}
+
+// snapshot returns a copy of p, safe to read without holding the mutex of
+// the database. Caller must hold it.
+func (p *CollectionProgress) snapshot() *CollectionProgress {
+	result := *p
+	if result.State == CollectionLoading {
+		result.Duration = time.Since(result.Start)
+	}
+	return &result
+}
+
+// setProgress creates or updates the state of a collection
+func (db *Database) setProgress(name string, f func(p *CollectionProgress)) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	p, exists := db.progress[name]
+	if !exists {
+		p = &CollectionProgress{
+			Name:  name,
+			Start: time.Now(),
+		}
+		db.progress[name] = p
+	}
+	f(p)
+}
+
+func (db *Database) setState(name, state string, err error) {
+	db.setProgress(name, func(p *CollectionProgress) {
+		p.State = state
+		if state != CollectionLoading && p.Duration == 0 {
+			p.Duration = time.Since(p.Start)
+		}
+		if err != nil {
+			p.Error = err.Error()
+		}
+	})
+}
+
+// GetProgress returns the state of a collection, nil if it does not exist
+func (db *Database) GetProgress(name string) *CollectionProgress {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	p, exists := db.progress[name]
+	if !exists {
+		return nil
+	}
+	return p.snapshot()
+}
+
+// ListProgress returns the state of every collection sorted by name
+func (db *Database) ListProgress() []*CollectionProgress {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	result := make([]*CollectionProgress, 0, len(db.progress))
+	for _, p := range db.progress {
+		result = append(result, p.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/fulldump/inceptiondb/collection"
+)
+
+var ErrCollectionNotFound = errors.New("collection not found")
+var ErrCollectionExists = errors.New("collection already exists")
+
+// entry is a ready collection in the registry of the database
+type entry struct {
+	collection *collection.Collection
+	inflight   *sync.RWMutex // held (R) by operations in progress, (W) by drop
+	dropped    bool          // protected by inflight
+}
+
+// GetCollection returns a ready collection
+func (db *Database) GetCollection(name string) (*collection.Collection, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	e, exists := db.collections[name]
+	if !exists {
+		return nil, false
+	}
+	return e.collection, true
+}
+
+// ListCollections returns the ready collections
+func (db *Database) ListCollections() map[string]*collection.Collection {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	result := make(map[string]*collection.Collection, len(db.collections))
+	for name, e := range db.collections {
+		result[name] = e.collection
+	}
+
+	return result
+}
+
+// AcquireCollection returns a ready collection that cannot be dropped until
+// release is called. A pending drop blocks new acquisitions.
+func (db *Database) AcquireCollection(name string) (col *collection.Collection, release func(), err error) {
+
+	db.mutex.RLock()
+	e, exists := db.collections[name]
+	db.mutex.RUnlock()
+	if !exists {
+		return nil, nil, ErrCollectionNotFound
+	}
+
+	e.inflight.RLock()
+	if e.dropped {
+		e.inflight.RUnlock()
+		return nil, nil, ErrCollectionNotFound
+	}
+
+	return e.collection, e.inflight.RUnlock, nil
+}
+
+// CreateCollection creates a new collection, init is called before it is
+// visible to anyone else
+func (db *Database) CreateCollection(name string, init func(col *collection.Collection) error) (*collection.Collection, error) {
+
+	db.createMutex.Lock()
+	defer db.createMutex.Unlock()
+
+	if db.GetProgress(name) != nil {
+		return nil, fmt.Errorf("collection '%s': %w", name, ErrCollectionExists)
+	}
+
+	return db.createCollection(name, init)
+}
+
+// GetOrCreateCollection returns the collection name, creating it if it does
+// not exist. Concurrent calls open the collection only once, and init is
+// called before it is visible to anyone else.
+func (db *Database) GetOrCreateCollection(name string, init func(col *collection.Collection) error) (*collection.Collection, error) {
+
+	col, exists := db.GetCollection(name)
+	if exists {
+		return col, nil
+	}
+
+	db.createMutex.Lock()
+	defer db.createMutex.Unlock()
+
+	col, exists = db.GetCollection(name)
+	if exists {
+		return col, nil
+	}
+	if db.GetProgress(name) != nil {
+		return nil, fmt.Errorf("collection '%s': %w", name, ErrCollectionExists) // loading, quarantined...
+	}
+
+	return db.createCollection(name, init)
+}
+
+// createCollection opens and registers a new collection. Caller must hold
+// createMutex.
+func (db *Database) createCollection(name string, init func(col *collection.Collection) error) (*collection.Collection, error) {
+
+	if collection.IsAuxiliaryFile(name) {
+		return nil, fmt.Errorf("collection name '%s' is reserved", name)
+	}
+
+	filename := path.Join(db.Config.Dir, name)
+	col, err := collection.OpenCollectionWithOptions(filename, db.Config.CollectionOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if init != nil {
+		err = init(col)
+		if err != nil {
+			col.Drop()
+			return nil, err
+		}
+	}
+
+	db.register(name, col)
+
+	return col, nil
+}
+
+// register makes a loaded collection ready
+func (db *Database) register(name string, col *collection.Collection) {
+
+	db.mutex.Lock()
+	db.collections[name] = &entry{
+		collection: col,
+		inflight:   &sync.RWMutex{},
+	}
+	db.mutex.Unlock()
+
+	db.setState(name, CollectionReady, nil)
+}
+
+// DropCollection removes a collection and its files once the operations in
+// progress (see AcquireCollection) finish
+func (db *Database) DropCollection(name string) error { // TODO: rename drop?
+
+	db.mutex.RLock()
+	e, exists := db.collections[name]
+	db.mutex.RUnlock()
+	if !exists {
+		return ErrCollectionNotFound
+	}
+
+	e.inflight.Lock()
+	defer e.inflight.Unlock()
+
+	if e.dropped {
+		return ErrCollectionNotFound // dropped while waiting
+	}
+
+	err := e.collection.Drop() // removes every journal file
+	if err != nil {
+		return fmt.Errorf("drop collection '%s': %w", name, err)
+	}
+	e.dropped = true
+
+	db.mutex.Lock()
+	delete(db.collections, name)
+	delete(db.progress, name)
+	db.mutex.Unlock()
+
+	return nil
+}
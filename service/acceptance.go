@@ -289,7 +289,7 @@ func Acceptance(a *biff.A, apiRequest func(method, path string) *apitest.Request
 			resp := apiRequest("POST", "/collections/my-collection:createIndex").
 				WithBodyJson(JSON{"name": "my-index", "type": "map", "field": "id", "sparse": true}).Do()
 
-			expectedBody := JSON{"type": "map", "name": "my-index", "field": "id", "sparse": true}
+			expectedBody := JSON{"type": "map", "name": "my-index", "field": "id", "sparse": true, "state": "ready"}
 			biff.AssertEqual(resp.StatusCode, http.StatusCreated)
 			biff.AssertEqualJson(resp.BodyJson(), expectedBody)
 
@@ -339,7 +339,7 @@ func Acceptance(a *biff.A, apiRequest func(method, path string) *apitest.Request
 				resp := apiRequest("POST", "/collections/my-collection:listIndexes").Do()
 				Save(resp, "List indexes", ``)
 
-				expectedBody := []JSON{{"type": "map", "name": "my-index", "field": "id", "sparse": true}}
+				expectedBody := []JSON{{"type": "map", "name": "my-index", "field": "id", "sparse": true, "state": "ready"}}
 				biff.AssertEqual(resp.StatusCode, http.StatusOK)
 				biff.AssertEqualJson(resp.BodyJson(), expectedBody)
 			})
@@ -359,7 +359,7 @@ func Acceptance(a *biff.A, apiRequest func(method, path string) *apitest.Request
 
 				expectedBody := JSON{
 					"error": JSON{
-						"description": "Unexpected error",
+						"description": "document rejected by index 'my-index'",
 						"message":     "index add 'my-index': index conflict: field 'id' with value 'my-id'",
 					},
 				}
@@ -367,6 +367,68 @@ func Acceptance(a *biff.A, apiRequest func(method, path string) *apitest.Request
 				biff.AssertEqual(resp.BodyJson(), expectedBody)
 			})
 
+			a.Alternative("Upsert", func(a *biff.A) {
+				resp := apiRequest("POST", "/collections/my-collection:upsert?index=my-index").
+					WithBodyJson(JSON{"id": "my-id", "name": "Fulanez"}).Do()
+				biff.AssertEqual(resp.StatusCode, http.StatusCreated)
+
+				resp = apiRequest("POST", "/collections/my-collection:upsert?index=my-index").
+					WithBodyJson(JSON{"id": "my-id", "name": "Menganez"}).Do()
+				Save(resp, "Upsert", ``)
+
+				expectedBody := JSON{"id": "my-id", "name": "Menganez"}
+				biff.AssertEqual(resp.StatusCode, http.StatusOK)
+				biff.AssertEqualJson(resp.BodyJson(), expectedBody)
+
+				a.Alternative("Replace", func(a *biff.A) {
+					resp := apiRequest("POST", "/collections/my-collection:replace?index=my-index").
+						WithBodyJson(JSON{"id": "my-id", "address": "Elm Street 11"}).Do()
+					Save(resp, "Replace", ``)
+
+					expectedBody := JSON{"id": "my-id", "address": "Elm Street 11"}
+					biff.AssertEqual(resp.StatusCode, http.StatusOK)
+					biff.AssertEqualJson(resp.BodyJson(), expectedBody)
+				})
+			})
+
+			a.Alternative("Patch - unique index conflict", func(a *biff.A) {
+				apiRequest("POST", "/collections/my-collection:insert").
+					WithBodyJson(JSON{"id": "a", "name": "Ana"}).Do()
+				apiRequest("POST", "/collections/my-collection:insert").
+					WithBodyJson(JSON{"id": "b", "name": "Bob"}).Do()
+
+				resp := apiRequest("POST", "/collections/my-collection:patch").
+					WithBodyJson(JSON{
+						"limit": 10,
+						"filter": JSON{
+							"id": "b",
+						},
+						"patch": JSON{
+							"id":   "a",
+							"name": "Bobby",
+						},
+					}).Do()
+				Save(resp, "Patch - unique index conflict", ``)
+
+				expectedBody := JSON{
+					"error": JSON{
+						"description": "document rejected by index 'my-index'",
+						"message":     "index add 'my-index': index conflict: field 'id' with value 'a'",
+					},
+				}
+				biff.AssertEqual(resp.StatusCode, http.StatusConflict)
+				biff.AssertEqual(resp.BodyJson(), expectedBody)
+
+				{
+					resp := apiRequest("POST", "/collections/my-collection:find").
+						WithBodyJson(JSON{
+							"index": "my-index",
+							"value": "b",
+						}).Do()
+					biff.AssertEqual(resp.BodyJson(), JSON{"id": "b", "name": "Bob"})
+				}
+			})
+
 			a.Alternative("Find with unique index", func(a *biff.A) {
 
 				myDocument := JSON{
@@ -461,7 +523,7 @@ func Acceptance(a *biff.A, apiRequest func(method, path string) *apitest.Request
 				WithBodyJson(JSON{"name": "my-index", "type": "btree", "fields": []string{"category", "product"}}).Do()
 			Save(resp, "Create index - btree", ``)
 
-			expectedBody := JSON{"name": "my-index", "type": "btree", "fields": []interface{}{"category", "product"}, "sparse": false, "unique": false}
+			expectedBody := JSON{"name": "my-index", "type": "btree", "fields": []interface{}{"category", "product"}, "sparse": false, "unique": false, "state": "ready"}
 			biff.AssertEqual(resp.StatusCode, http.StatusCreated)
 			biff.AssertEqual(resp.BodyJson(), expectedBody)
 
@@ -795,7 +857,10 @@ func Acceptance(a *biff.A, apiRequest func(method, path string) *apitest.Request
 				### 3. ´auto()´
 				**Description**: Implements an automatic row counter that increments with each insert, starting from 
 				the first insertion. This function is beneficial for maintaining a sequential order or count of the
-				documents added to the collection.
+				documents added to the collection. ´auto(<name>)´ takes the value from a named sequence instead, so
+				several fields (or several kinds of numbering) can be kept apart. Sequences are persisted, they can
+				be listed with ´:listSequences´ and reset with ´:resetSequence´ (´{"name": "orders", "value": 1000}´),
+				and values already taken in a unique index are skipped.
 				
 				**Example Usage**: Useful for auto-increment fields, such as a serial number, order number, or any
 				scenario where a simple, incrementing counter is needed.
@@ -803,6 +868,17 @@ func Acceptance(a *biff.A, apiRequest func(method, path string) *apitest.Request
 				**Output Example**: ´"serial_number": 1023´ (where 1023 is the current count of documents inserted 
 				since the first one)
 				
+				### 4. More generators
+				
+				**Description**: ´uuidv7()´ and ´ulid()´ generate time ordered identifiers, ´now()´ the insertion time in
+				RFC 3339 (UTC) and ´token(n)´ a random string of n letters and digits (32 if n is omitted).
+				´auto(<name>, <width>)´ zero pads the value of the sequence to width digits, as a string. Fields can be
+				nested with dots, like ´meta.createdAt´, and ´onupdate(<generator>)´ is also applied by every patch that
+				changes the document (unless the patch sets the field itself). Unknown functions or invalid arguments are
+				rejected when the defaults are set.
+				
+				**Output Example**: ´{"number": "000042", "meta": {"createdAt": "2024-02-07T10:20:30.123456789Z"}}´
+				
 				### Implementation Considerations
 
 				When integrating generative functions with ´SetDefaults´, consider the following:
@@ -4,13 +4,22 @@ import (
 	"errors"
 
 	"github.com/fulldump/inceptiondb/collection"
+	"github.com/fulldump/inceptiondb/database"
 )
 
 var ErrorCollectionNotFound = errors.New("collection not found")
+var ErrorCollectionLoading = errors.New("collection is loading")
+var ErrorCollectionQuarantined = errors.New("collection is quarantined")
+var ErrorCollectionClosing = errors.New("collection is closing")
 
 type Servicer interface { // todo: review naming
-	CreateCollection(name string) (*collection.Collection, error)
+	CreateCollection(name string, defaults map[string]any) (*collection.Collection, error)
+	GetOrCreateCollection(name string, defaults map[string]any) (*collection.Collection, error)
 	GetCollection(name string) (*collection.Collection, error)
+	AcquireCollection(name string) (col *collection.Collection, release func(), err error)
 	ListCollections() map[string]*collection.Collection
 	DeleteCollection(name string) error
+	RecoverCollection(name, recovery string) (*collection.Collection, error)
+	GetProgress(name string) *database.CollectionProgress
+	ListProgress() []*database.CollectionProgress
 }
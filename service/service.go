@@ -1,63 +1,134 @@
 package service
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"path"
 
 	"github.com/fulldump/inceptiondb/collection"
 	"github.com/fulldump/inceptiondb/database"
+	"github.com/fulldump/inceptiondb/utils"
 )
 
 type Service struct {
-	db          *database.Database
-	collections map[string]*collection.Collection
+	db *database.Database
 }
 
 func NewService(db *database.Database) *Service {
 	return &Service{
-		db:          db,
-		collections: db.Collections, // todo: remove from here
+		db: db,
 	}
 }
 
 var ErrorCollectionAlreadyExists = errors.New("collection already exists")
+var ErrorCollectionNameReserved = errors.New("collection name is reserved")
 
-func (s *Service) CreateCollection(name string) (*collection.Collection, error) {
-	_, exist := s.collections[name]
-	if exist {
+// CreateCollection creates a new collection with defaults, if not nil
+func (s *Service) CreateCollection(name string, defaults map[string]any) (*collection.Collection, error) {
+
+	if collection.IsAuxiliaryFile(name) {
+		return nil, ErrorCollectionNameReserved
+	}
+
+	col, err := s.db.CreateCollection(name, setDefaults(defaults))
+	if errors.Is(err, database.ErrCollectionExists) {
 		return nil, ErrorCollectionAlreadyExists
 	}
 
-	filename := path.Join(s.db.Config.Dir, name)
+	return col, err
+}
 
-	collection, err := collection.OpenCollection(filename)
-	if err != nil {
-		return nil, err
+// GetOrCreateCollection returns the collection, creating it with defaults (if
+// not nil) when it does not exist. Concurrent calls create it only once.
+func (s *Service) GetOrCreateCollection(name string, defaults map[string]any) (*collection.Collection, error) {
+
+	if collection.IsAuxiliaryFile(name) {
+		return nil, ErrorCollectionNameReserved
+	}
+
+	col, err := s.db.GetOrCreateCollection(name, setDefaults(defaults))
+	if errors.Is(err, database.ErrCollectionExists) {
+		return s.GetCollection(name) // not ready, explain why
 	}
 
-	s.collections[name] = collection
+	return col, err
+}
 
-	return collection, nil
+func setDefaults(defaults map[string]any) func(col *collection.Collection) error {
+	if defaults == nil {
+		return nil
+	}
+	return func(col *collection.Collection) error {
+		return col.SetDefaults(defaults)
+	}
 }
 
 func (s *Service) GetCollection(name string) (*collection.Collection, error) {
-	collection, exist := s.collections[name]
-	if !exist {
+	collection, exist := s.db.GetCollection(name)
+	if exist {
+		return collection, nil
+	}
+
+	progress := s.db.GetProgress(name)
+	if progress == nil {
 		return nil, ErrorCollectionNotFound
 	}
 
-	return collection, nil
+	switch progress.State {
+	case database.CollectionLoading:
+		return nil, ErrorCollectionLoading
+	case database.CollectionQuarantined:
+		return nil, fmt.Errorf("%w: %s", ErrorCollectionQuarantined, progress.Error)
+	case database.CollectionClosing:
+		return nil, ErrorCollectionClosing
+	}
+
+	return nil, ErrorCollectionNotFound
+}
+
+// AcquireCollection returns the collection, it will not be dropped until
+// release is called
+func (s *Service) AcquireCollection(name string) (col *collection.Collection, release func(), err error) {
+
+	col, release, err = s.db.AcquireCollection(name)
+	if err == database.ErrCollectionNotFound {
+		_, err = s.GetCollection(name) // not ready, explain why
+		if err == nil {
+			err = ErrorCollectionNotFound // dropped meanwhile
+		}
+	}
+
+	return col, release, err
 }
 
 func (s *Service) ListCollections() map[string]*collection.Collection {
-	return s.collections
+	return s.db.ListCollections()
+}
+
+func (s *Service) RecoverCollection(name, recovery string) (*collection.Collection, error) {
+	return s.db.RecoverCollection(name, recovery)
+}
+
+func (s *Service) GetProgress(name string) *database.CollectionProgress {
+	return s.db.GetProgress(name)
+}
+
+func (s *Service) ListProgress() []*database.CollectionProgress {
+	return s.db.ListProgress()
 }
 
 func (s *Service) DeleteCollection(name string) error {
-	return s.db.DropCollection(name)
+	_, err := s.GetCollection(name)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.DropCollection(name)
+	if err == database.ErrCollectionNotFound {
+		return ErrorCollectionNotFound
+	}
+
+	return err
 }
 
 var ErrorInsertBadJson = errors.New("insert bad json")
@@ -65,13 +136,13 @@ var ErrorInsertConflict = errors.New("insert conflict")
 
 func (s *Service) Insert(name string, data io.Reader) error {
 
-	collection, exists := s.db.Collections[name]
+	collection, exists := s.db.GetCollection(name)
 	if !exists {
 		// TODO: here create collection :D
 		return ErrorCollectionNotFound
 	}
 
-	jsonReader := json.NewDecoder(data)
+	jsonReader := utils.NewJSONDecoder(data)
 
 	for {
 		item := map[string]interface{}{}
@@ -92,6 +163,4 @@ func (s *Service) Insert(name string, data io.Reader) error {
 
 		// jsonWriter.Encode(item)
 	}
-
-	return nil
 }
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// NewJSONDecoder returns a decoder that keeps numbers as json.Number, so that
+// integers above 2^53 are not rounded to float64
+func NewJSONDecoder(r io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder
+}
+
+// DecodeJSON is json.Unmarshal keeping numbers as json.Number
+func DecodeJSON(data []byte, v interface{}) error {
+
+	decoder := NewJSONDecoder(bytes.NewReader(data))
+	err := decoder.Decode(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+
+	return nil
+}
+
+// ToNumber returns a number (json.Number or any Go number) as json.Number
+func ToNumber(value interface{}) (json.Number, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return v, true
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), true
+	case float32:
+		return json.Number(strconv.FormatFloat(float64(v), 'g', -1, 32)), true
+	case int:
+		return json.Number(strconv.FormatInt(int64(v), 10)), true
+	case int8:
+		return json.Number(strconv.FormatInt(int64(v), 10)), true
+	case int16:
+		return json.Number(strconv.FormatInt(int64(v), 10)), true
+	case int32:
+		return json.Number(strconv.FormatInt(int64(v), 10)), true
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), true
+	case uint:
+		return json.Number(strconv.FormatUint(uint64(v), 10)), true
+	case uint8:
+		return json.Number(strconv.FormatUint(uint64(v), 10)), true
+	case uint16:
+		return json.Number(strconv.FormatUint(uint64(v), 10)), true
+	case uint32:
+		return json.Number(strconv.FormatUint(uint64(v), 10)), true
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10)), true
+	}
+	return "", false
+}
+
+// CompareNumbers compares two numbers exactly, whatever their size or
+// representation (2, 2.0 and 2e0 are equal). Invalid numbers fail.
+func CompareNumbers(a, b json.Number) (int, error) {
+
+	// fast path, most numbers are small integers
+	if x, err := strconv.ParseInt(string(a), 10, 64); err == nil {
+		if y, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	x, err := parseDecimal(string(a))
+	if err != nil {
+		return 0, err
+	}
+	y, err := parseDecimal(string(b))
+	if err != nil {
+		return 0, err
+	}
+
+	return x.compare(y), nil
+}
+
+// decimal is a number as 0.<digits> * 10^exp, digits without leading or
+// trailing zeros (empty for zero)
+type decimal struct {
+	negative bool
+	digits   string
+	exp      int
+}
+
+func parseDecimal(s string) (*decimal, error) {
+
+	invalid := fmt.Errorf("invalid number '%s'", s)
+	d := &decimal{}
+
+	if strings.HasPrefix(s, "-") {
+		d.negative = true
+		s = s[1:]
+	}
+
+	mantissa, exponent, hasExponent := strings.Cut(strings.ToLower(s), "e")
+	exp := 0
+	if hasExponent {
+		var err error
+		exp, err = strconv.Atoi(exponent)
+		if err != nil || exp > 1e9 || exp < -1e9 {
+			return nil, invalid
+		}
+	}
+
+	integer, fraction, _ := strings.Cut(mantissa, ".")
+	if integer == "" || strings.Trim(integer+fraction, "0123456789") != "" {
+		return nil, invalid
+	}
+
+	digits := integer + fraction
+	exp += len(integer)
+	trimmed := strings.TrimLeft(digits, "0")
+	exp -= len(digits) - len(trimmed)
+	d.digits = strings.TrimRight(trimmed, "0")
+	d.exp = exp
+
+	if d.digits == "" {
+		d.negative = false // -0 is 0
+		d.exp = 0
+	}
+
+	return d, nil
+}
+
+func (d *decimal) compare(other *decimal) int {
+
+	sign := 1
+	if d.negative {
+		sign = -1
+	}
+
+	switch {
+	case d.digits == "" && other.digits == "":
+		return 0
+	case d.digits == "":
+		if other.negative {
+			return 1
+		}
+		return -1
+	case other.digits == "":
+		return sign
+	case d.negative != other.negative:
+		return sign
+	case d.exp != other.exp:
+		if d.exp > other.exp {
+			return sign
+		}
+		return -sign
+	}
+
+	return sign * strings.Compare(d.digits, other.digits)
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/fulldump/biff"
+)
+
+func TestCompareNumbers(t *testing.T) {
+
+	cases := []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1", "2", -1},
+		{"2", "2.0", 0},
+		{"2e0", "0.2e1", 0},
+		{"-0", "0.0", 0},
+		{"9007199254740993", "9007199254740992", 1},
+		{"18446744073709551616", "18446744073709551615", 1},
+		{"-18446744073709551616", "-18446744073709551615", -1},
+		{"9007199254740993", "9007199254740993.5", -1},
+		{"0.1", "0.10000000000000001", -1},
+		{"-1", "1e-300", -1},
+		{"1e300", "99999", 1},
+		{"-1e300", "-99999", -1},
+		{"0.001", "1e-3", 0},
+		{"12", "123e-1", -1},
+	}
+
+	for _, c := range cases {
+		cmp, err := CompareNumbers(json.Number(c.a), json.Number(c.b))
+		AssertNil(err)
+		if cmp != c.cmp {
+			t.Errorf("CompareNumbers(%s, %s) = %d, expected %d", c.a, c.b, cmp, c.cmp)
+		}
+	}
+
+	_, err := CompareNumbers("1", "one")
+	AssertNotNil(err)
+}
+
+func TestDecodeJSON(t *testing.T) {
+
+	item := map[string]interface{}{}
+	err := DecodeJSON([]byte(`{"n": 9007199254740993}`), &item)
+	AssertNil(err)
+	AssertEqual(item["n"], json.Number("9007199254740993"))
+
+	err = DecodeJSON([]byte(`{} {}`), &item)
+	AssertNotNil(err)
+}